@@ -12,11 +12,15 @@ func main() {
 	<-c
 }
 
+// aligner: shared by every wfAlign call, which the single threaded js runtime never runs concurrently,
+// its pool keeps at most wfa.MaxPooledOffsets offsets however long the alignments were
+var aligner = &wfa.Aligner{}
+
 func wfAlign(this js.Value, args []js.Value) interface{} {
-	if len(args) != 4 {
+	if len(args) != 4 && len(args) != 5 {
 		resultMap := map[string]interface{}{
 			"ok":    false,
-			"error": "invalid number of args, requires 4: s1, s2, penalties, doCIGAR",
+			"error": "invalid number of args, requires 4 or 5: s1, s2, penalties, doCIGAR, options",
 		}
 		return js.ValueOf(resultMap)
 	}
@@ -69,6 +73,14 @@ func wfAlign(this js.Value, args []js.Value) interface{} {
 		E: e,
 	}
 
+	// the second gap piece is only read by the gap-affine-2p distance
+	if !args[2].Get("o2").IsUndefined() {
+		penalties.O2 = args[2].Get("o2").Int()
+	}
+	if !args[2].Get("e2").IsUndefined() {
+		penalties.E2 = args[2].Get("e2").Int()
+	}
+
 	if args[3].Type() != js.TypeBoolean {
 		resultMap := map[string]interface{}{
 			"ok":    false,
@@ -79,18 +91,191 @@ func wfAlign(this js.Value, args []js.Value) interface{} {
 
 	doCIGAR := args[3].Bool()
 
-	// Call the actual func.
-	result := wfa.WFAlign(s1, s2, penalties, doCIGAR)
+	options := wfa.Options{}
+	if len(args) == 5 {
+		var err string
+		options, err = parseOptions(args[4])
+		if err != "" {
+			resultMap := map[string]interface{}{
+				"ok":    false,
+				"error": err,
+			}
+			return js.ValueOf(resultMap)
+		}
+	}
+
+	// Call the actual func, reusing the wavefronts of earlier calls.
+	aligner.Penalties = penalties
+	aligner.Options = options
+	result, err := aligner.AlignChecked(s1, s2, doCIGAR)
+	if err != nil {
+		resultMap := map[string]interface{}{
+			"ok":    false,
+			"error": err.Error(),
+		}
+		return js.ValueOf(resultMap)
+	}
+	if result.Status != wfa.StatusOK {
+		resultMap := map[string]interface{}{
+			"ok":     true,
+			"status": result.Status.String(),
+			"error":  "",
+		}
+		return js.ValueOf(resultMap)
+	}
+	alignment := result.Alignment()
+	ops := make([]interface{}, len(alignment.Ops))
+	for i, run := range alignment.Ops {
+		ops[i] = map[string]interface{}{
+			"op":     run.Op.String(),
+			"length": run.Length,
+		}
+	}
 	resultMap := map[string]interface{}{
-		"ok":    true,
-		"score": result.Score,
-		"CIGAR": result.CIGAR,
-		"error": "",
+		"ok":      true,
+		"status":  alignment.Status.String(),
+		"score":   alignment.Score,
+		"CIGAR":   alignment.CIGAR,
+		"ops":     ops,
+		"s1Begin": alignment.S1Begin,
+		"s1End":   alignment.S1End,
+		"s2Begin": alignment.S2Begin,
+		"s2End":   alignment.S2End,
+
+		"matches":               alignment.Matches,
+		"mismatches":            alignment.Mismatches,
+		"insertions":            alignment.Insertions,
+		"deletions":             alignment.Deletions,
+		"gapOpens":              alignment.GapOpens,
+		"identity":              alignment.Identity,
+		"gapCompressedIdentity": alignment.GapCompressedIdentity,
+
+		"suboptimal": alignment.Suboptimal,
+		"error":      "",
 	}
 
 	return js.ValueOf(resultMap)
 }
 
+// parseOptions: reads the optional options map of wfAlign, returning an error message if it is malformed
+func parseOptions(value js.Value) (wfa.Options, string) {
+	options := wfa.Options{}
+
+	if value.Type() != js.TypeObject {
+		return options, "options should be a map"
+	}
+
+	memory := value.Get("memory")
+	if !memory.IsUndefined() {
+		if memory.Type() != js.TypeString || (memory.String() != "high" && memory.String() != "ultralow") {
+			return options, "options.memory should be one of high, ultralow"
+		}
+		if memory.String() == "ultralow" {
+			options.Memory = wfa.MemoryUltralow
+		}
+	}
+
+	distance := value.Get("distance")
+	if !distance.IsUndefined() {
+		distances := map[string]wfa.Distance{
+			"gap-affine":    wfa.DistanceGapAffine,
+			"gap-affine-2p": wfa.DistanceGapAffine2p,
+			"gap-linear":    wfa.DistanceGapLinear,
+			"edit":          wfa.DistanceEdit,
+			"indel":         wfa.DistanceIndel,
+		}
+		d, ok := distances[distance.String()]
+		if distance.Type() != js.TypeString || !ok {
+			return options, "options.distance should be one of gap-affine, gap-affine-2p, gap-linear, edit, indel"
+		}
+		options.Distance = d
+	}
+
+	endsFree := value.Get("endsFree")
+	if !endsFree.IsUndefined() {
+		if endsFree.Type() != js.TypeObject {
+			return options, "options.endsFree should be a map with key values s1Begin, s1End, s2Begin, s2End"
+		}
+		free := []int{0, 0, 0, 0}
+		for i, key := range []string{"s1Begin", "s1End", "s2Begin", "s2End"} {
+			v := endsFree.Get(key)
+			if v.IsUndefined() {
+				continue
+			}
+			if v.Type() != js.TypeNumber {
+				return options, "options.endsFree." + key + " should be a number"
+			}
+			free[i] = v.Int()
+		}
+		options.Span = wfa.SpanEndsFree
+		options.EndsFree = wfa.EndsFree{
+			S1Begin: free[0],
+			S1End:   free[1],
+			S2Begin: free[2],
+			S2End:   free[3],
+		}
+	}
+
+	local := value.Get("local")
+	if !local.IsUndefined() {
+		if local.Type() != js.TypeBoolean {
+			return options, "options.local should be a boolean"
+		}
+		if local.Bool() {
+			options.Span = wfa.SpanLocal
+		}
+	}
+
+	reduction := value.Get("reduction")
+	if !reduction.IsUndefined() {
+		if reduction.Type() != js.TypeObject {
+			return options, "options.reduction should be a map with key values minWavefrontLength, maxDistance, steps"
+		}
+		params := []int{0, 0, 1}
+		for i, key := range []string{"minWavefrontLength", "maxDistance", "steps"} {
+			v := reduction.Get(key)
+			if v.IsUndefined() {
+				continue
+			}
+			if v.Type() != js.TypeNumber {
+				return options, "options.reduction." + key + " should be a number"
+			}
+			params[i] = v.Int()
+		}
+		options.Heuristic.Reduction = &wfa.Reduction{
+			MinWavefrontLength: params[0],
+			MaxDistance:        params[1],
+			Steps:              params[2],
+		}
+	}
+
+	maxScore := value.Get("maxScore")
+	if !maxScore.IsUndefined() {
+		if maxScore.Type() != js.TypeNumber {
+			return options, "options.maxScore should be a number"
+		}
+		options.Bounded = true
+		options.MaxScore = maxScore.Int()
+	}
+
+	for _, key := range []string{"xDrop", "zDrop"} {
+		v := value.Get(key)
+		if v.IsUndefined() {
+			continue
+		}
+		if v.Type() != js.TypeNumber {
+			return options, "options." + key + " should be a number"
+		}
+		if key == "xDrop" {
+			options.Heuristic.XDrop = v.Int()
+		} else {
+			options.Heuristic.ZDrop = v.Int()
+		}
+	}
+
+	return options, ""
+}
+
 func DecodeCIGAR(this js.Value, args []js.Value) interface{} {
 	if len(args) != 1 {
 		println("invalid number of args, requires 1: CIGAR")
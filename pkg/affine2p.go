@@ -0,0 +1,103 @@
+package wfa
+
+// set the next lo and hi bounds for wavefronts M, I, D, I2, D2 of the two-piece gap-affine distance
+func NextLoHi2p(M *WavefrontComponent, I *WavefrontComponent, D *WavefrontComponent, I2 *WavefrontComponent, D2 *WavefrontComponent, score int, penalties Penalty) (int, int) {
+	x := penalties.X
+	o := penalties.O
+	e := penalties.E
+	o2 := penalties.O2
+	e2 := penalties.E2
+
+	a_ok, a_lo, a_hi := M.GetLoHi(score - x)
+	b_ok, b_lo, b_hi := M.GetLoHi(score - o - e)
+	c_ok, c_lo, c_hi := I.GetLoHi(score - e)
+	d_ok, d_lo, d_hi := D.GetLoHi(score - e)
+	f_ok, f_lo, f_hi := M.GetLoHi(score - o2 - e2)
+	g_ok, g_lo, g_hi := I2.GetLoHi(score - e2)
+	h_ok, h_lo, h_hi := D2.GetLoHi(score - e2)
+
+	ok_lo, idx := SafeArgMin(
+		[]bool{a_ok, b_ok, c_ok, d_ok, f_ok, g_ok, h_ok},
+		[]int{a_lo, b_lo, c_lo, d_lo, f_lo, g_lo, h_lo},
+	)
+	lo := SafeMin([]int{a_lo, b_lo, c_lo, d_lo, f_lo, g_lo, h_lo}, idx) - 1
+
+	ok_hi, idx := SafeArgMax(
+		[]bool{a_ok, b_ok, c_ok, d_ok, f_ok, g_ok, h_ok},
+		[]int{a_hi, b_hi, c_hi, d_hi, f_hi, g_hi, h_hi},
+	)
+	hi := SafeMax([]int{a_hi, b_hi, c_hi, d_hi, f_hi, g_hi, h_hi}, idx) + 1
+
+	if ok_lo && ok_hi {
+		M.SetLoHi(score, lo, hi)
+		I.SetLoHi(score, lo, hi)
+		D.SetLoHi(score, lo, hi)
+		I2.SetLoHi(score, lo, hi)
+		D2.SetLoHi(score, lo, hi)
+	}
+	return lo, hi
+}
+
+// set the traceback and diag value for the next I2 wavefront, opening from M at score-o2-e2 or extending I2 at score-e2
+func NextI2(M_open *Wavefront, I2_extd *Wavefront, I2 *Wavefront, k int) {
+	a_ok, a := M_open.Offset(k - 1)
+	b_ok, b := I2_extd.Offset(k - 1)
+
+	ok, nextITraceback := SafeArgMax([]bool{a_ok, b_ok}, []uint64{a, b})
+	nextIVal := SafeMax([]uint64{a, b}, nextITraceback) + 1 // important that the +1 is here
+	if ok {
+		I2.Set(k, nextIVal, []Traceback{OpenIns2, ExtdIns2}[nextITraceback])
+	}
+}
+
+// set the traceback and diag value for the next D2 wavefront, opening from M at score-o2-e2 or extending D2 at score-e2
+func NextD2(M_open *Wavefront, D2_extd *Wavefront, D2 *Wavefront, k int) {
+	a_ok, a := M_open.Offset(k + 1)
+	b_ok, b := D2_extd.Offset(k + 1)
+
+	ok, nextDTraceback := SafeArgMax([]bool{a_ok, b_ok}, []uint64{a, b})
+	nextDVal := SafeMax([]uint64{a, b}, nextDTraceback)
+	if ok {
+		D2.Set(k, nextDVal, []Traceback{OpenDel2, ExtdDel2}[nextDTraceback])
+	}
+}
+
+// set the traceback and diag value for the next M wavefront of the two-piece gap-affine distance
+func NextM2p(M_sub *Wavefront, I *Wavefront, D *Wavefront, I2 *Wavefront, D2 *Wavefront, M *Wavefront, k int) {
+	a_ok, a := M_sub.Offset(k)
+	a++ // important to have +1 here
+	b_ok, b := I.Offset(k)
+	c_ok, c := D.Offset(k)
+	d_ok, d := I2.Offset(k)
+	f_ok, f := D2.Offset(k)
+
+	ok, nextMTraceback := SafeArgMax([]bool{a_ok, b_ok, c_ok, d_ok, f_ok}, []uint64{a, b, c, d, f})
+	nextMVal := SafeMax([]uint64{a, b, c, d, f}, nextMTraceback)
+	if ok {
+		M.Set(k, nextMVal, []Traceback{Sub, Ins, Del, Ins2, Del2}[nextMTraceback])
+	}
+}
+
+func WFNext2p(M *WavefrontComponent, I *WavefrontComponent, D *WavefrontComponent, I2 *WavefrontComponent, D2 *WavefrontComponent, score int, penalties Penalty) {
+	// get this score's lo, hi
+	lo, hi := NextLoHi2p(M, I, D, I2, D2, score, penalties)
+
+	// the wavefronts read and written are looked up once rather than for each diagonal
+	M_sub := M.W.Get(score - penalties.X)
+	M_open := M.W.Get(score - penalties.O - penalties.E)
+	I_extd := I.W.Get(score - penalties.E)
+	D_extd := D.W.Get(score - penalties.E)
+	M_open2 := M.W.Get(score - penalties.O2 - penalties.E2)
+	I2_extd := I2.W.Get(score - penalties.E2)
+	D2_extd := D2.W.Get(score - penalties.E2)
+	M_next, I_next, D_next := M.W.Get(score), I.W.Get(score), D.W.Get(score)
+	I2_next, D2_next := I2.W.Get(score), D2.W.Get(score)
+
+	for k := lo; k <= hi; k++ { // for each diagonal, extend the matrices for the next wavefronts
+		NextI(M_open, I_extd, I_next, k)
+		NextD(M_open, D_extd, D_next, k)
+		NextI2(M_open2, I2_extd, I2_next, k)
+		NextD2(M_open2, D2_extd, D2_next, k)
+		NextM2p(M_sub, I_next, D_next, I2_next, D2_next, M_next, k)
+	}
+}
@@ -0,0 +1,58 @@
+package wfa
+
+import "context"
+
+// Aligner: aligns pairs of sequences under fixed penalties and options, reusing the wavefront memory of its earlier alignments
+// the zero value aligns with the zero Penalty and Options, and an Aligner must not align concurrently,
+// so keep one per goroutine or share them through a sync.Pool
+type Aligner struct {
+	Penalties Penalty
+	Options   Options
+	pool      *WavefrontPool
+}
+
+// NewAligner: returns an Aligner for penalties and options
+func NewAligner(penalties Penalty, options Options) *Aligner {
+	return &Aligner{
+		Penalties: penalties,
+		Options:   options,
+		pool:      NewWavefrontPool(),
+	}
+}
+
+// Align: same as WFAlignWithOptions(s1, s2, a.Penalties, doCIGAR, a.Options) without allocating the wavefronts which earlier alignments left
+// the arguments are not checked, see AlignChecked
+func (a *Aligner) Align(s1 string, s2 string, doCIGAR bool) Result {
+	if a.pool == nil {
+		a.pool = NewWavefrontPool()
+	}
+	return wfAlignOptions(context.Background(), stringPair{s1: s1, s2: s2}, a.Penalties, doCIGAR, a.Options, a.pool)
+}
+
+// AlignChecked: same as WFAlignChecked(s1, s2, a.Penalties, doCIGAR, a.Options) without allocating the wavefronts which earlier alignments left
+func (a *Aligner) AlignChecked(s1 string, s2 string, doCIGAR bool) (Result, error) {
+	return a.AlignContext(context.Background(), s1, s2, doCIGAR)
+}
+
+// AlignContext: same as WFAlignContext(ctx, s1, s2, a.Penalties, doCIGAR, a.Options) without allocating the wavefronts which earlier alignments left
+func (a *Aligner) AlignContext(ctx context.Context, s1 string, s2 string, doCIGAR bool) (Result, error) {
+	return a.AlignSequences(ctx, stringPair{s1: s1, s2: s2}, doCIGAR)
+}
+
+// AlignDNA: same as WFAlignDNA(s1, s2, a.Penalties, doCIGAR, a.Options) without allocating the wavefronts which earlier alignments left
+func (a *Aligner) AlignDNA(s1 DNA, s2 DNA, doCIGAR bool) (Result, error) {
+	return a.AlignSequences(context.Background(), DNASequences(s1, s2), doCIGAR)
+}
+
+// AlignSequences: same as WFAlignSequences(ctx, seqs, a.Penalties, doCIGAR, a.Options) without allocating the wavefronts which earlier alignments left
+func (a *Aligner) AlignSequences(ctx context.Context, seqs Sequences, doCIGAR bool) (Result, error) {
+	if a.pool == nil {
+		a.pool = NewWavefrontPool()
+	}
+	return wfAlignContext(ctx, seqs, a.Penalties, doCIGAR, a.Options, a.pool)
+}
+
+// Reset: releases the memory kept from earlier alignments, for example after an unusually long one, the configuration is kept
+func (a *Aligner) Reset() {
+	a.pool = nil
+}
@@ -0,0 +1,104 @@
+package wfa
+
+// Op: an operation of a CIGAR, M a match and X a mismatch of a character of s1 with one of s2,
+// I a character of s2 inserted and D a character of s1 deleted
+type Op byte
+
+const (
+	OpMatch     Op = 'M'
+	OpMismatch  Op = 'X'
+	OpInsertion Op = 'I'
+	OpDeletion  Op = 'D'
+)
+
+func (op Op) String() string {
+	return string(rune(op))
+}
+
+// MarshalText: the op as its letter, so that it is written as "M" rather than a number in JSON
+func (op Op) MarshalText() ([]byte, error) {
+	return []byte{byte(op)}, nil
+}
+
+// MarshalText: the status as its String, such as "ok"
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// OpRun: Length consecutive operations Op, one run of a CIGAR
+type OpRun struct {
+	Op     Op  `json:"op"`
+	Length int `json:"length"`
+}
+
+// Ops: the runs of a runlength encoded CIGAR, without decoding it
+func Ops(CIGAR string) []OpRun {
+	ops := []OpRun{}
+	count := 0
+	for i := 0; i < len(CIGAR); i++ {
+		if CIGAR[i] >= '0' && CIGAR[i] <= '9' {
+			count = count*10 + int(CIGAR[i]-'0')
+			continue
+		}
+		ops = append(ops, OpRun{Op: Op(CIGAR[i]), Length: count})
+		count = 0
+	}
+	return ops
+}
+
+// Alignment: a Result with its CIGAR as typed runs and the statistics of its operations, which are 0 without a CIGAR
+type Alignment struct {
+	Status  Status  `json:"status"`
+	Score   int     `json:"score"`
+	CIGAR   string  `json:"CIGAR"`
+	Ops     []OpRun `json:"ops"`
+	S1Begin int     `json:"s1Begin"`
+	S1End   int     `json:"s1End"`
+	S2Begin int     `json:"s2Begin"`
+	S2End   int     `json:"s2End"`
+
+	Matches    int `json:"matches"`
+	Mismatches int `json:"mismatches"`
+	Insertions int `json:"insertions"` // characters of s2 missing from s1
+	Deletions  int `json:"deletions"`  // characters of s1 missing from s2
+	GapOpens   int `json:"gapOpens"`   // runs of I and of D
+
+	Identity              float64 `json:"identity"`              // BLAST identity, matches over all the columns of the alignment, 0 without any
+	GapCompressedIdentity float64 `json:"gapCompressedIdentity"` // matches over the matches, mismatches and gaps, each gap counted once whatever its length
+
+	Suboptimal bool `json:"suboptimal"`
+}
+
+// Alignment: r with its operations and their statistics
+func (r Result) Alignment() Alignment {
+	a := Alignment{
+		Status:     r.Status,
+		Score:      r.Score,
+		CIGAR:      r.CIGAR,
+		Ops:        Ops(r.CIGAR),
+		S1Begin:    r.S1Begin,
+		S1End:      r.S1End,
+		S2Begin:    r.S2Begin,
+		S2End:      r.S2End,
+		Suboptimal: r.Suboptimal,
+	}
+	for _, run := range a.Ops {
+		switch run.Op {
+		case OpMatch:
+			a.Matches = a.Matches + run.Length
+		case OpMismatch:
+			a.Mismatches = a.Mismatches + run.Length
+		case OpInsertion:
+			a.Insertions = a.Insertions + run.Length
+			a.GapOpens++
+		case OpDeletion:
+			a.Deletions = a.Deletions + run.Length
+			a.GapOpens++
+		}
+	}
+	if columns := a.Matches + a.Mismatches + a.Insertions + a.Deletions; columns > 0 {
+		a.Identity = float64(a.Matches) / float64(columns)
+		a.GapCompressedIdentity = float64(a.Matches) / float64(a.Matches+a.Mismatches+a.GapOpens)
+	}
+	return a
+}
@@ -0,0 +1,85 @@
+package wfa
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Pair: two sequences to align, ID is passed on to the BatchResult to tell the results apart
+type Pair struct {
+	ID int
+	S1 string
+	S2 string
+}
+
+// BatchResult: the Result of aligning the pair with ID, unless Err tells why it could not be aligned, such as the errors of Validate
+type BatchResult struct {
+	ID     int
+	Result Result
+	Err    error
+}
+
+// AlignBatch: aligns every pair with penalties and options across workers goroutines, or one per CPU if workers <= 0,
+// each of which reuses its wavefront memory, returning the results in the order of pairs
+func AlignBatch(pairs []Pair, penalties Penalty, doCIGAR bool, options Options, workers int) []BatchResult {
+	results := make([]BatchResult, len(pairs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range batchWorkers(workers, len(pairs)) {
+		wg.Go(func() {
+			aligner := NewAligner(penalties, options)
+			for i := range next {
+				results[i] = alignPair(aligner, pairs[i], doCIGAR)
+			}
+		})
+	}
+	for i := range pairs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// AlignStream: aligns the pairs received on pairs with penalties and options across workers goroutines, or one per CPU if workers <= 0,
+// each of which reuses its wavefront memory, sending the results as they finish so they are told apart by ID
+// the returned channel is closed once pairs is closed and every pair received is aligned
+func AlignStream(pairs <-chan Pair, penalties Penalty, doCIGAR bool, options Options, workers int) <-chan BatchResult {
+	results := make(chan BatchResult)
+	var wg sync.WaitGroup
+	for range batchWorkers(workers, MaxInt) {
+		wg.Go(func() {
+			aligner := NewAligner(penalties, options)
+			for pair := range pairs {
+				results <- alignPair(aligner, pair, doCIGAR)
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// batchWorkers: the number of goroutines to align pairs with, at most one per pair
+func batchWorkers(workers int, pairs int) int {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return max(min(workers, pairs), 1)
+}
+
+// alignPair: aligns pair with aligner after checking it, turning a panic into the error of its result so that one pair cannot stop the others
+func alignPair(aligner *Aligner, pair Pair, doCIGAR bool) (result BatchResult) {
+	result.ID = pair.ID
+	defer func() {
+		if r := recover(); r != nil {
+			aligner.Reset() // the wavefronts of the failed alignment were not returned to the pool
+			result.Err = fmt.Errorf("wfa: aligning pair %d: %v", pair.ID, r)
+		}
+	}()
+	result.Result, result.Err = aligner.AlignChecked(pair.S1, pair.S2, doCIGAR)
+	return result
+}
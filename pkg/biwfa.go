@@ -0,0 +1,416 @@
+package wfa
+
+import "context"
+
+// alignments whose score is at most BiWFAFallbackScore are solved with the unidirectional WFA
+// since its O(s^2) memory is bounded at that point
+const BiWFAFallbackScore = 250
+
+// Breakpoint: a point where an optimal path crosses from the forward wavefronts into the reverse wavefronts
+type Breakpoint struct {
+	Score     int       // score of the whole path through the breakpoint
+	ScoreF    int       // score of the path up to the breakpoint
+	K         int       // forward diagonal of the breakpoint
+	Offset    int       // forward offset of the breakpoint
+	Component Component // component in which both halves meet
+
+	Suboptimal bool // a heuristic dropped part of the wavefronts during the search
+}
+
+// biwfaHalf: one direction of the breakpoint search, keeping only the last few wavefronts in rings
+type biwfaHalf struct {
+	M         *WavefrontComponent
+	I         *WavefrontComponent
+	D         *WavefrontComponent
+	I2        *WavefrontComponent
+	D2        *WavefrontComponent
+	seqs      Sequences
+	free      EndsFree  // free begins of this direction
+	target    EndsFree  // free ends of this direction, which the other one begins within
+	begin     Component // component the half begins in
+	p         WFPenalties
+	heuristic Heuristic
+	ctx       context.Context // cancels the search from WFExtend
+	score     int
+	initial   int
+	reduced   bool // the reduction dropped diagonals of this half
+	reduce    ReduceState
+}
+
+// newBiWFAHalf: returns a half initialized for a path beginning in component begin, or within the free begins, and extended at its initial score
+// the half keeps the last keep wavefronts, taken from pool, and its reduction keeps the diagonals reaching the free ends of target
+func newBiWFAHalf(ctx context.Context, seqs Sequences, begin Component, free EndsFree, target EndsFree, p WFPenalties, heuristic Heuristic, keep int, pool *WavefrontPool) *biwfaHalf {
+	h := &biwfaHalf{
+		M:         pool.Component(keep),
+		I:         pool.Component(keep),
+		D:         pool.Component(keep),
+		I2:        pool.Component(keep),
+		D2:        pool.Component(keep),
+		seqs:      seqs,
+		free:      free,
+		target:    target,
+		begin:     begin,
+		p:         p,
+		heuristic: heuristic,
+		ctx:       ctx,
+	}
+	h.score = WFInit(h.M, h.I, h.D, h.I2, h.D2, begin, free, p.Skip, p.Penalty)
+	h.initial = h.score
+	WFExtend(ctx, h.M, h.seqs, h.score)
+	return h
+}
+
+// step: computes and extends the next wavefront, which replaces the oldest one kept
+func (h *biwfaHalf) step() {
+	h.score = h.score + 1
+	wfNext(h.M, h.I, h.D, h.I2, h.D2, h.score, h.p)
+	WFSources(h.M, h.score, h.free, h.p.Skip)
+	WFExtend(h.ctx, h.M, h.seqs, h.score)
+	n, m := h.seqs.Lens()
+	if h.heuristic.Reduction != nil && WFReduce([]*WavefrontComponent{h.M, h.I, h.D, h.I2, h.D2}, h.score, n, m, h.target, *h.heuristic.Reduction, &h.reduce) {
+		h.reduced = true
+	}
+}
+
+// release: returns the wavefronts of the half to pool, after which it must no longer be used
+func (h *biwfaHalf) release(pool *WavefrontPool) {
+	pool.Release(h.M, h.I, h.D, h.I2, h.D2)
+}
+
+// BiWFAlign: aligns seqs with O(s) memory by finding a breakpoint between forward and reverse wavefronts and recursing on both halves
+// the alignment is given up with StatusMaxScoreExceeded once its translated score has to exceed bound
+func BiWFAlign(ctx context.Context, seqs Sequences, p WFPenalties, heuristic Heuristic, bound int, doCIGAR bool, free EndsFree, pool *WavefrontPool) Result {
+	if heuristic.Extension() {
+		return biwfaExtension(ctx, seqs, p, heuristic, doCIGAR, pool)
+	}
+
+	rseqs := seqs.Reverse()
+	bp := BiWFABreakpoint(ctx, seqs, rseqs, p, heuristic, bound, ComponentM, ComponentM, free, pool)
+	if bp.Score == MaxInt {
+		return Result{Status: StatusMaxScoreExceeded}
+	}
+
+	if doCIGAR {
+		return biwfaSplit(ctx, seqs, rseqs, p, heuristic, ComponentM, ComponentM, free, bp, pool)
+	}
+	n, m := seqs.Lens()
+
+	// without the CIGAR only the score is known, so free ends are reported as unknown
+	result := Result{
+		Score:   bp.Score,
+		S1Begin: 0,
+		S1End:   n,
+		S2Begin: 0,
+		S2End:   m,
+
+		Suboptimal: bp.Suboptimal,
+	}
+	if free.S1Begin != 0 {
+		result.S1Begin = -1
+	}
+	if free.S1End != 0 {
+		result.S1End = -1
+	}
+	if free.S2Begin != 0 {
+		result.S2Begin = -1
+	}
+	if free.S2End != 0 {
+		result.S2End = -1
+	}
+	return result
+}
+
+// biwfaExtension: finds the end of the best prefix alignment under the X-drop and Z-drop with a forward half keeping only the last wavefronts
+// with doCIGAR the path the heuristics found is backtraced as the other memory modes do, from wavefronts the drop keeps narrow
+func biwfaExtension(ctx context.Context, seqs Sequences, p WFPenalties, heuristic Heuristic, doCIGAR bool, pool *WavefrontPool) Result {
+	if doCIGAR { // the prefixes may align for less end-to-end than along the path found, so they are not realigned
+		return wfAlign(ctx, seqs, p, heuristic, MaxInt, true, ComponentM, ComponentM, EndsFree{}, pool)
+	}
+
+	n, m := seqs.Lens()
+	keep := p.MaxStep() + 1
+	forward := newBiWFAHalf(ctx, seqs, ComponentM, EndsFree{}, EndsFree{}, p, heuristic, keep, pool)
+	drop := NewDropState(forward.score, p.MaxStep())
+	for !WFDrop([]*WavefrontComponent{forward.M, forward.I, forward.D, forward.I2, forward.D2}, forward.score, n, m, p, heuristic, &drop) {
+		forward.step()
+	}
+	forward.release(pool)
+
+	return Result{
+		Score:   drop.WavefrontScore - forward.initial,
+		S1Begin: 0,
+		S1End:   drop.Offset - drop.K,
+		S2Begin: 0,
+		S2End:   drop.Offset,
+
+		Suboptimal: forward.reduced || drop.Dropped,
+	}
+}
+
+// biwfaAlign: aligns seqs from component begin to component end given the score of that alignment, rseqs holds seqs reversed
+func biwfaAlign(ctx context.Context, seqs Sequences, rseqs Sequences, p WFPenalties, heuristic Heuristic, begin Component, end Component, free EndsFree, score int, pool *WavefrontPool) Result {
+	n, m := seqs.Lens()
+
+	if n == 0 || m == 0 {
+		return biwfaTrivial(n, m, p, begin, end, free)
+	}
+
+	if score <= BiWFAFallbackScore {
+		return wfAlign(ctx, seqs, p, heuristic, MaxInt, true, begin, end, free, pool)
+	}
+
+	bp := BiWFABreakpoint(ctx, seqs, rseqs, p, heuristic, MaxInt, begin, end, free, pool)
+	v := bp.Offset - bp.K
+	if (v == 0 && bp.Offset == 0 && free.S1Begin == 0 && free.S2Begin == 0) || (v == n && bp.Offset == m && free.S1End == 0 && free.S2End == 0) {
+		// the breakpoint sits at an end of the alignment, splitting would not make progress
+		return wfAlign(ctx, seqs, p, heuristic, MaxInt, true, begin, end, free, pool)
+	}
+	return biwfaSplit(ctx, seqs, rseqs, p, heuristic, begin, end, free, bp, pool)
+}
+
+// biwfaTrivial: aligns s1, s2 when one of them is empty, as a single gap between skipping as much of the free ends as pays off
+func biwfaTrivial(n int, m int, p WFPenalties, begin Component, end Component, free EndsFree) Result {
+	length := n + m
+	op := "D"
+	gaps := []Component{ComponentD, ComponentD2}
+	freeBegin := free.S1Begin
+	freeEnd := free.S1End
+	if n == 0 {
+		op = "I"
+		gaps = []Component{ComponentI, ComponentI2}
+		freeBegin = free.S2Begin
+		freeEnd = free.S2End
+	}
+	if p.Distance != DistanceGapAffine2p { // only the two-piece distance has a second gap piece
+		gaps = gaps[:1]
+	}
+
+	// the score is linear in the number of skipped characters as long as some gap remains, so only the extremes need checking
+	best := MaxInt
+	best_b := 0
+	best_e := 0
+	for _, gap := range gaps {
+		extend := p.E
+		if gap == ComponentI2 || gap == ComponentD2 {
+			extend = p.E2
+		}
+		for _, b := range []int{0, min(freeBegin, length)} {
+			for _, e := range []int{0, min(freeEnd, length-b)} {
+				rest := length - b - e
+				score := p.Skip * (b + e)
+				if rest > 0 {
+					score = score + rest*extend
+					if begin != gap || b != 0 { // unless the gap continues the one the path begins in, it has to be opened
+						score = score + p.Open(gap)
+					}
+				}
+				if end != ComponentM && (end != gap || rest == 0 || e != 0) && (length != 0 || begin != end) { // the path has to finish in a gap of component end, unless it is empty and already in one
+					score = score + p.Open(end)
+				}
+				if score < best {
+					best = score
+					best_b = b
+					best_e = e
+				}
+			}
+		}
+	}
+
+	result := Result{Score: best}
+	if rest := length - best_b - best_e; rest > 0 {
+		result.CIGAR = UIntToString(uint(rest)) + op
+	}
+	if n == 0 {
+		result.S2Begin = best_b
+		result.S2End = m - best_e
+	} else {
+		result.S1Begin = best_b
+		result.S1End = n - best_e
+	}
+	return result
+}
+
+// biwfaSplit: splits seqs at bp and joins the alignments of both halves
+func biwfaSplit(ctx context.Context, seqs Sequences, rseqs Sequences, p WFPenalties, heuristic Heuristic, begin Component, end Component, free EndsFree, bp Breakpoint, pool *WavefrontPool) Result {
+	n, m := seqs.Lens()
+	h := bp.Offset
+	v := h - bp.K
+
+	// the free begins stay with the left half and the free ends with the right half
+	leftFree := EndsFree{S1Begin: min(free.S1Begin, v), S2Begin: min(free.S2Begin, h)}
+	rightFree := EndsFree{S1End: min(free.S1End, n-v), S2End: min(free.S2End, m-h)}
+
+	left := biwfaAlign(ctx, seqs.Slice(0, v, 0, h), rseqs.Slice(n-v, n, m-h, m), p, heuristic, begin, bp.Component, leftFree, bp.ScoreF, pool)
+	right := biwfaAlign(ctx, seqs.Slice(v, n, h, m), rseqs.Slice(0, n-v, 0, m-h), p, heuristic, bp.Component, end, rightFree, bp.Score-bp.ScoreF, pool)
+
+	// the halves add up to bp.Score unless a heuristic made them miss the paths the breakpoint was found on, or their gaps join
+	return Result{
+		Score:   left.Score + right.Score,
+		CIGAR:   JoinCIGAR(left.CIGAR, right.CIGAR),
+		S1Begin: left.S1Begin,
+		S1End:   v + right.S1End,
+		S2Begin: left.S2Begin,
+		S2End:   h + right.S2End,
+
+		Suboptimal: bp.Suboptimal || left.Suboptimal || right.Suboptimal,
+	}
+}
+
+// BiWFABreakpoint: advances forward wavefronts over seqs and reverse wavefronts over rseqs, seqs reversed, until they overlap and returns the best breakpoint
+// the forward wavefronts start within the free begins and the reverse wavefronts within the free ends
+// the search gives up once no breakpoint can score at most bound, returning a breakpoint with Score MaxInt
+func BiWFABreakpoint(ctx context.Context, seqs Sequences, rseqs Sequences, p WFPenalties, heuristic Heuristic, bound int, begin Component, end Component, free EndsFree, pool *WavefrontPool) Breakpoint {
+	o := max(p.O, p.O2)
+	maxStep := p.MaxStep()
+	// any optimal path has a breakpoint whose forward and reverse scores differ by at most maxStep,
+	// plus one for the half which is a step ahead of the other
+	scope := maxStep + 1
+	keep := max(maxStep, scope) + 1
+
+	forward := newBiWFAHalf(ctx, seqs, begin, EndsFree{S1Begin: free.S1Begin, S2Begin: free.S2Begin}, EndsFree{S1End: free.S1End, S2End: free.S2End}, p, heuristic, keep, pool)
+	reverse := newBiWFAHalf(ctx, rseqs, end, EndsFree{S1Begin: free.S1End, S2Begin: free.S2End}, EndsFree{S1End: free.S1Begin, S2End: free.S2Begin}, p, heuristic, keep, pool)
+
+	bp := Breakpoint{Score: MaxInt}
+	biwfaOverlap(forward, reverse, forward.score, reverse.score, &bp)
+	biwfaEndsFree(forward, reverse, true, &bp)
+	biwfaEndsFree(forward, reverse, false, &bp)
+
+	for {
+		if bp.Score != MaxInt || bound != MaxInt {
+			target := bp.Score
+			if bp.Score > bound { // only breakpoints within bound are of interest
+				target = bound + 1
+			}
+			// every pair of wavefronts which could still produce a score below target has been checked
+			limit := (target + forward.initial + o + scope) / 2
+			if forward.score > limit && reverse.score > limit {
+				if bp.Score > bound {
+					bp.Score = MaxInt
+				}
+				break
+			}
+		}
+
+		if forward.score <= reverse.score {
+			forward.step()
+			for sr := max(reverse.initial, reverse.score-scope); sr <= reverse.score; sr++ {
+				biwfaOverlap(forward, reverse, forward.score, sr, &bp)
+			}
+			biwfaEndsFree(forward, reverse, true, &bp)
+		} else {
+			reverse.step()
+			for sf := max(forward.initial, forward.score-scope); sf <= forward.score; sf++ {
+				biwfaOverlap(forward, reverse, sf, reverse.score, &bp)
+			}
+			biwfaEndsFree(forward, reverse, false, &bp)
+		}
+	}
+
+	bp.Suboptimal = forward.reduced || reverse.reduced
+	forward.release(pool)
+	reverse.release(pool)
+	return bp
+}
+
+// biwfaEndsFree: checks whether the current forward (or reverse) wavefront reached the free ends (or free begins) on its own,
+// which finds breakpoints of paths whose skipped characters cost more than half of their score
+// a reduced half may pass the other one without overlapping, so then reaching the end on its own is checked as well
+func biwfaEndsFree(forward *biwfaHalf, reverse *biwfaHalf, isForward bool, bp *Breakpoint) {
+	n, m := forward.seqs.Lens()
+	reduction := forward.heuristic.Reduction != nil
+
+	if isForward {
+		free := reverse.free
+		if free.S1Begin == 0 && free.S2Begin == 0 && !reduction {
+			return
+		}
+		ok, k, total := WFEndsFreeReached(forward.M, forward.score, n, m, EndsFree{S1End: free.S1Begin, S2End: free.S2Begin}, forward.p.Skip)
+		total = total + forward.p.Open(reverse.begin) // a path finishing in a gap ends in a zero length one
+		if ok && total-forward.initial < bp.Score {
+			_, h := forward.M.GetOffset(forward.score, k)
+			*bp = Breakpoint{
+				Score:     total - forward.initial,
+				ScoreF:    forward.score - forward.initial,
+				K:         k,
+				Offset:    int(h),
+				Component: ComponentM,
+			}
+		}
+	} else {
+		free := forward.free
+		if free.S1Begin == 0 && free.S2Begin == 0 && !reduction {
+			return
+		}
+		ok, k, total := WFEndsFreeReached(reverse.M, reverse.score, n, m, EndsFree{S1End: free.S1Begin, S2End: free.S2Begin}, reverse.p.Skip)
+		if ok && total < bp.Score {
+			_, h := reverse.M.GetOffset(reverse.score, k)
+			*bp = Breakpoint{
+				Score:     total,
+				ScoreF:    total - reverse.score,
+				K:         m - n - k,
+				Offset:    m - int(h),
+				Component: ComponentM,
+			}
+		}
+	}
+}
+
+// biwfaOverlap: checks the forward wavefront at score sf against the reverse wavefront at score sr and records the breakpoint if it improves bp
+func biwfaOverlap(forward *biwfaHalf, reverse *biwfaHalf, sf int, sr int, bp *Breakpoint) {
+	n, m := forward.seqs.Lens()
+	A_k := m - n
+
+	if sf+sr-forward.initial-max(forward.p.O, forward.p.O2) >= bp.Score { // no breakpoint here can improve on bp
+		return
+	}
+
+	f_ok, f_lo, f_hi := forward.M.GetLoHi(sf)
+	r_ok, r_lo, r_hi := reverse.M.GetLoHi(sr)
+	if !f_ok || !r_ok {
+		return
+	}
+
+	forwardWavefronts := []*Wavefront{forward.M.W.Get(sf), forward.I.W.Get(sf), forward.D.W.Get(sf), forward.I2.W.Get(sf), forward.D2.W.Get(sf)}
+	reverseWavefronts := []*Wavefront{reverse.M.W.Get(sr), reverse.I.W.Get(sr), reverse.D.W.Get(sr), reverse.I2.W.Get(sr), reverse.D2.W.Get(sr)}
+
+	last := ComponentD
+	if forward.p.Distance.Linear() { // linear distances only have the M component
+		last = ComponentM
+	} else if forward.p.Distance == DistanceGapAffine2p {
+		last = ComponentD2
+	}
+
+	// reverse diagonal k_r corresponds to forward diagonal A_k - k_r
+	for k := max(f_lo, A_k-r_hi); k <= min(f_hi, A_k-r_lo); k++ {
+		for c := ComponentM; c <= last; c++ {
+			f_valid, f_h := forwardWavefronts[c].Offset(k)
+			if !f_valid {
+				continue
+			}
+			r_valid, r_h := reverseWavefronts[c].Offset(A_k - k)
+			if !r_valid || int(f_h)+int(r_h) < m {
+				continue
+			}
+			if !biwfaInBounds(int(f_h), k, n, m) || !biwfaInBounds(int(r_h), A_k-k, n, m) {
+				continue
+			}
+
+			score := sf + sr - forward.initial - forward.p.Open(c) // both halves paid to open the gap they meet in
+			if score < bp.Score {
+				*bp = Breakpoint{
+					Score:     score,
+					ScoreF:    sf - forward.initial,
+					K:         k,
+					Offset:    int(f_h),
+					Component: c,
+				}
+			}
+		}
+	}
+}
+
+// biwfaInBounds: whether offset h on diagonal k lies inside the n x m alignment matrix
+func biwfaInBounds(h int, k int, n int, m int) bool {
+	v := h - k
+	return 0 <= h && h <= m && 0 <= v && v <= n
+}
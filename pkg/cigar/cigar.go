@@ -0,0 +1,326 @@
+package cigar
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	wfa "wfa/pkg"
+)
+
+var (
+	ErrMalformed = errors.New("cigar: malformed CIGAR")                  // the CIGAR cannot be parsed, or has runs which no alignment has
+	ErrMismatch  = errors.New("cigar: CIGAR does not fit the sequences") // the CIGAR does not align the sequences it is checked against
+	ErrNoCIGAR   = errors.New("cigar: result has no CIGAR")              // the result was aligned without doCIGAR, so its ends may be unknown
+)
+
+// the operations of SAM CIGARs besides those of wfa.Op, where s1 is the reference and s2 the query
+const (
+	OpEqual    wfa.Op = '=' // a match in the extended flavor, where M is not used
+	OpSoftClip wfa.Op = 'S' // characters of s2 left unaligned at either end
+	OpHardClip wfa.Op = 'H' // characters of s2 removed at either end, which it no longer holds
+)
+
+// CIGAR: the runs of an alignment of s1 with s2, in one of three flavors
+// the CIGARs of the wfa package use M for a match and X for a mismatch, the extended flavor of SAM uses = and X,
+// and the M-only flavor of SAM uses M for both, which Expand resolves with the sequences
+type CIGAR []wfa.OpRun
+
+// Parse: the runs of a runlength encoded CIGAR such as 3M1X2I, returning an error wrapping ErrMalformed for a missing or zero length,
+// a length with leading zeros, an unknown operation or clips which are not at the ends, the empty CIGAR is the empty alignment
+// the runs are read by wfa.Ops, which skips no character, so a CIGAR it reads is well formed when its runs write it back unchanged
+func Parse(s string) (CIGAR, error) {
+	c := CIGAR(wfa.Ops(s))
+	if written := c.String(); written != s {
+		i := 0
+		for i < len(s) && i < len(written) && s[i] == written[i] {
+			i++
+		}
+		return nil, fmt.Errorf("%w: the run at %d is not a length without leading zeros followed by an operation", ErrMalformed, i)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate: checks that every run has a positive length of at most wfa.MaxSequenceLength and an operation of M, =, X, I, D, S or H, and that the clips are at the ends
+// with the hard clips outside the soft ones, returning an error wrapping ErrMalformed if not
+func (c CIGAR) Validate() error {
+	for i, run := range c {
+		if run.Length <= 0 || uint64(run.Length) > wfa.MaxSequenceLength {
+			return fmt.Errorf("%w: run %d has length %d", ErrMalformed, i, run.Length)
+		}
+		switch run.Op {
+		case wfa.OpMatch, OpEqual, wfa.OpMismatch, wfa.OpInsertion, wfa.OpDeletion:
+		case OpHardClip:
+			if i != 0 && i != len(c)-1 {
+				return fmt.Errorf("%w: hard clip of run %d is not at an end", ErrMalformed, i)
+			}
+		case OpSoftClip:
+			first := i == 0 || (i == 1 && c[0].Op == OpHardClip)
+			last := i == len(c)-1 || (i == len(c)-2 && c[len(c)-1].Op == OpHardClip)
+			if !first && !last {
+				return fmt.Errorf("%w: soft clip of run %d is not at an end", ErrMalformed, i)
+			}
+		default:
+			return fmt.Errorf("%w: run %d has unknown operation %q", ErrMalformed, i, byte(run.Op))
+		}
+	}
+	return nil
+}
+
+// String: the runlength encoded CIGAR
+func (c CIGAR) String() string {
+	var s strings.Builder
+	for _, run := range c {
+		s.WriteString(wfa.UIntToString(uint(run.Length)))
+		s.WriteByte(byte(run.Op))
+	}
+	return s.String()
+}
+
+// consumes: how many characters of s1 and of s2 each operation of op advances by
+func consumes(op wfa.Op) (int, int) {
+	switch op {
+	case wfa.OpMatch, OpEqual, wfa.OpMismatch:
+		return 1, 1
+	case wfa.OpDeletion:
+		return 1, 0
+	case wfa.OpInsertion, OpSoftClip:
+		return 0, 1
+	default:
+		return 0, 0
+	}
+}
+
+// Lens: the number of characters of s1 and of s2 the CIGAR covers, with the soft clipped characters of s2 but not the hard clipped ones
+func (c CIGAR) Lens() (int, int) {
+	n, m := 0, 0
+	for _, run := range c {
+		dv, dh := consumes(run.Op)
+		n = n + dv*run.Length
+		m = m + dh*run.Length
+	}
+	return n, m
+}
+
+// Merge: c with adjacent runs of the same operation joined
+func (c CIGAR) Merge() CIGAR {
+	merged := make(CIGAR, 0, len(c))
+	for _, run := range c {
+		if len(merged) > 0 && merged[len(merged)-1].Op == run.Op {
+			merged[len(merged)-1].Length = merged[len(merged)-1].Length + run.Length
+			continue
+		}
+		merged = append(merged, run)
+	}
+	return merged
+}
+
+// Invert: the CIGAR aligning s2 with s1, with I and D swapped
+// the clips of s2 cannot be carried over to s1, so they are removed
+func (c CIGAR) Invert() CIGAR {
+	inverted := make(CIGAR, 0, len(c))
+	for _, run := range c {
+		switch run.Op {
+		case wfa.OpInsertion:
+			run.Op = wfa.OpDeletion
+		case wfa.OpDeletion:
+			run.Op = wfa.OpInsertion
+		case OpSoftClip, OpHardClip:
+			continue
+		}
+		inverted = append(inverted, run)
+	}
+	return inverted
+}
+
+// Score: the score of the alignment under penalties and distance, as the wfa package scores its results,
+// where M and = are matches, each run of I or D is one gap taking the cheaper piece under wfa.DistanceGapAffine2p, and clips cost nothing
+// returns an error wrapping ErrMalformed for a mismatch under wfa.DistanceIndel, which has none
+func (c CIGAR) Score(penalties wfa.Penalty, distance wfa.Distance) (int, error) {
+	switch distance {
+	case wfa.DistanceGapLinear:
+		penalties.O = 0
+	case wfa.DistanceEdit:
+		penalties = wfa.Penalty{M: 0, X: 1, O: 0, E: 1}
+	case wfa.DistanceIndel:
+		penalties = wfa.Penalty{M: 0, X: 0, O: 0, E: 1}
+	}
+
+	score := 0
+	for i, run := range c.Merge() {
+		switch run.Op {
+		case wfa.OpMatch, OpEqual:
+			score = score + run.Length*penalties.M
+		case wfa.OpMismatch:
+			if distance == wfa.DistanceIndel {
+				return 0, fmt.Errorf("%w: run %d is a mismatch, which the indel distance does not have", ErrMalformed, i)
+			}
+			score = score + run.Length*penalties.X
+		case wfa.OpInsertion, wfa.OpDeletion:
+			gap := penalties.O + run.Length*penalties.E
+			if distance == wfa.DistanceGapAffine2p {
+				gap = min(gap, penalties.O2+run.Length*penalties.E2)
+			}
+			score = score + gap
+		}
+	}
+	return score, nil
+}
+
+// Verify: checks that c aligns all of s1 with all of s2, where M and = have to be matches and X a mismatch as in the CIGARs of the wfa package,
+// returning an error wrapping ErrMismatch if not, an M-only CIGAR has to be expanded first
+func (c CIGAR) Verify(s1 string, s2 string) error {
+	if n, m := c.Lens(); n != len(s1) || m != len(s2) {
+		return fmt.Errorf("%w: the CIGAR covers %d and %d characters, the sequences have %d and %d", ErrMismatch, n, m, len(s1), len(s2))
+	}
+	v, h := 0, 0
+	for i, run := range c {
+		dv, dh := consumes(run.Op)
+		if dv == 1 && dh == 1 {
+			for j := 0; j < run.Length; j++ {
+				if (s1[v+j] == s2[h+j]) != (run.Op != wfa.OpMismatch) {
+					return fmt.Errorf("%w: run %d %c aligns %q of s1[%d] with %q of s2[%d]", ErrMismatch, i, byte(run.Op), s1[v+j], v+j, s2[h+j], h+j)
+				}
+			}
+		}
+		v = v + dv*run.Length
+		h = h + dh*run.Length
+	}
+	return nil
+}
+
+// FromResult: the CIGAR of result, checked to align s1[S1Begin:S1End] with s2[S2Begin:S2End], nil for a result which is not StatusOK or aligns nothing
+// returns an error wrapping ErrNoCIGAR for a result aligned without doCIGAR, and one wrapping ErrMismatch
+// for coordinates outside of s1, s2 or a CIGAR which does not align them
+func FromResult(result wfa.Result, s1 string, s2 string) (CIGAR, error) {
+	if result.Status != wfa.StatusOK {
+		return nil, nil
+	}
+	unknown := result.S1Begin < 0 || result.S1End < 0 || result.S2Begin < 0 || result.S2End < 0 // free ends of a score-only alignment
+	if result.CIGAR == "" && (unknown || result.S1End > result.S1Begin || result.S2End > result.S2Begin) {
+		return nil, ErrNoCIGAR
+	}
+	if unknown || result.S1Begin > result.S1End || result.S1End > len(s1) || result.S2Begin > result.S2End || result.S2End > len(s2) {
+		return nil, fmt.Errorf("%w: s1[%d:%d], s2[%d:%d] are out of the %d and %d characters of the sequences", ErrMismatch, result.S1Begin, result.S1End, result.S2Begin, result.S2End, len(s1), len(s2))
+	}
+	if result.CIGAR == "" {
+		return nil, nil
+	}
+	c, err := Parse(result.CIGAR)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Verify(s1[result.S1Begin:result.S1End], s2[result.S2Begin:result.S2End]); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Slice: the part of c aligning s1[v_begin:v_end] with s2[h_begin:h_end], the insertions before s1[v_begin] and after s1[v_end-1]
+// and the clips are left out, so s2[h_begin:h_end] runs from where s1[v_begin] is aligned to just after where s1[v_end-1] is
+// panics if v_begin, v_end are out of the range of s1 the CIGAR covers
+func (c CIGAR) Slice(v_begin int, v_end int) (CIGAR, int, int) {
+	if n, _ := c.Lens(); v_begin < 0 || v_begin > v_end || v_end > n {
+		panic("cigar: slice bounds out of range")
+	}
+	sliced := CIGAR{}
+	v, h := 0, 0
+	h_begin, h_end := -1, -1
+	h_last := 0 // where s2 is after the last run consuming s1, or after the leading clips
+	for i, run := range c {
+		dv, dh := consumes(run.Op)
+		if dv == 0 {
+			if run.Op == wfa.OpInsertion && v_begin < v && v < v_end {
+				sliced = append(sliced, run)
+			}
+			h = h + dh*run.Length
+			if run.Op == OpSoftClip && i <= 1 {
+				h_last = h
+			}
+			continue
+		}
+		if h_begin < 0 && v_begin < v+run.Length {
+			h_begin = h + dh*(v_begin-v)
+		}
+		if h_end < 0 && v_begin < v_end && v_end <= v+run.Length {
+			h_end = h + dh*(v_end-v)
+		}
+		if overlap := min(v+run.Length, v_end) - max(v, v_begin); overlap > 0 {
+			sliced = append(sliced, wfa.OpRun{Op: run.Op, Length: overlap})
+		}
+		v = v + run.Length
+		h = h + dh*run.Length
+		h_last = h
+	}
+	if h_begin < 0 { // v_begin is the end of s1
+		h_begin = h_last
+	}
+	if v_begin == v_end {
+		h_end = h_begin
+	}
+	return sliced, h_begin, h_end
+}
+
+// Collapse: the M-only flavor of c, with = and X as M
+func (c CIGAR) Collapse() CIGAR {
+	collapsed := make(CIGAR, len(c))
+	for i, run := range c {
+		if run.Op == OpEqual || run.Op == wfa.OpMismatch {
+			run.Op = wfa.OpMatch
+		}
+		collapsed[i] = run
+	}
+	return collapsed.Merge()
+}
+
+// Expand: the extended flavor of an M-only CIGAR aligning s1 with s2, each M split into runs of = and X
+// returns an error wrapping ErrMismatch if c does not cover s1 and s2
+func (c CIGAR) Expand(s1 string, s2 string) (CIGAR, error) {
+	if n, m := c.Lens(); n != len(s1) || m != len(s2) {
+		return nil, fmt.Errorf("%w: the CIGAR covers %d and %d characters, the sequences have %d and %d", ErrMismatch, n, m, len(s1), len(s2))
+	}
+	expanded := make(CIGAR, 0, len(c))
+	v, h := 0, 0
+	for _, run := range c {
+		dv, dh := consumes(run.Op)
+		if run.Op != wfa.OpMatch {
+			expanded = append(expanded, run)
+		}
+		for j := 0; run.Op == wfa.OpMatch && j < run.Length; j++ {
+			op := OpEqual
+			if s1[v+j] != s2[h+j] {
+				op = wfa.OpMismatch
+			}
+			expanded = append(expanded, wfa.OpRun{Op: op, Length: 1})
+		}
+		v = v + dv*run.Length
+		h = h + dh*run.Length
+	}
+	return expanded.Merge(), nil
+}
+
+// Extended: the extended flavor of a CIGAR of the wfa package, where every M is a match and becomes =
+func (c CIGAR) Extended() CIGAR {
+	extended := make(CIGAR, len(c))
+	for i, run := range c {
+		if run.Op == wfa.OpMatch {
+			run.Op = OpEqual
+		}
+		extended[i] = run
+	}
+	return extended
+}
+
+// Native: the flavor of the wfa package of an extended CIGAR, with = as M
+func (c CIGAR) Native() CIGAR {
+	native := make(CIGAR, len(c))
+	for i, run := range c {
+		if run.Op == OpEqual {
+			run.Op = wfa.OpMatch
+		}
+		native[i] = run
+	}
+	return native
+}
@@ -1,24 +1,72 @@
 package wfa
 
+import "math/bits"
+
+// PositiveSlice: slice indexed by nonnegative idx which grows on Set, or with a nonzero ring only holds the last ring indices set
 type PositiveSlice[T any] struct {
 	data         []T
 	valid        []bool
 	defaultValue T
+	ring         int   // number of slots of a ring, a power of two, 0 for a growing slice
+	keys         []int // idx held by each slot of a ring, -1 if the slot was never set
+}
+
+// NewRingSlice: returns a PositiveSlice holding at least the last size indices set, size is rounded up to a power of two
+// so that idx reuses the slot of idx-size with a mask
+func NewRingSlice[T any](size int, defaultValue T) *PositiveSlice[T] {
+	size = RingSize(size)
+	a := &PositiveSlice[T]{
+		data:         make([]T, size),
+		valid:        make([]bool, size),
+		defaultValue: defaultValue,
+		ring:         size,
+		keys:         make([]int, size),
+	}
+	for i := range a.keys {
+		a.keys[i] = -1
+	}
+	return a
+}
+
+// RingSize: the number of slots of a ring holding size indices
+func RingSize(size int) int {
+	return 1 << bits.Len(uint(max(size, 1)-1))
+}
+
+// slot: returns where idx is stored and whether it is currently there
+func (a *PositiveSlice[T]) slot(idx int) (int, bool) {
+	if idx < 0 {
+		return 0, false
+	}
+	if a.ring == 0 {
+		return idx, idx < len(a.valid) && a.valid[idx]
+	}
+	s := idx & (a.ring - 1)
+	return s, a.valid[s] && a.keys[s] == idx
 }
 
 func (a *PositiveSlice[T]) Valid(idx int) bool {
-	return 0 <= idx && idx < len(a.valid) && a.valid[idx]
+	_, ok := a.slot(idx)
+	return ok
 }
 
 func (a *PositiveSlice[T]) Get(idx int) T {
-	if 0 <= idx && idx < len(a.valid) && a.valid[idx] { // idx is in the slice
-		return a.data[idx]
+	if s, ok := a.slot(idx); ok { // idx is in the slice
+		return a.data[s]
 	} else { // idx is out of the slice
 		return a.defaultValue
 	}
 }
 
 func (a *PositiveSlice[T]) Set(idx int, value T) {
+	if a.ring != 0 { // replace whatever the slot held
+		s := idx & (a.ring - 1)
+		a.data[s] = value
+		a.valid[s] = true
+		a.keys[s] = idx
+		return
+	}
+
 	if idx >= len(a.valid) { // idx is outside the slice
 		// expand data array to 2*idx
 		newData := make([]T, 2*idx+1)
@@ -34,3 +82,39 @@ func (a *PositiveSlice[T]) Set(idx int, value T) {
 	a.data[idx] = value
 	a.valid[idx] = true
 }
+
+// Unset: marks idx as invalid and releases the value stored there, a ring keeps the value for Recycle
+func (a *PositiveSlice[T]) Unset(idx int) {
+	s, ok := a.slot(idx)
+	if !ok {
+		return
+	}
+	a.valid[s] = false
+	if a.ring == 0 {
+		var zero T
+		a.data[s] = zero
+	}
+}
+
+// Recycle: returns the value which Set(idx) replaces in a ring so that its memory can be reused, false if there is none
+func (a *PositiveSlice[T]) Recycle(idx int) (T, bool) {
+	if a.ring == 0 || idx < 0 || a.keys[idx&(a.ring-1)] < 0 {
+		return a.defaultValue, false
+	}
+	return a.data[idx&(a.ring-1)], true
+}
+
+// Reset: empties the slice keeping its memory, passing every value it still holds to release, a ring also passes the values kept for Recycle
+func (a *PositiveSlice[T]) Reset(release func(T)) {
+	var zero T
+	for i := range a.data {
+		if a.valid[i] || (a.ring != 0 && a.keys[i] >= 0) {
+			release(a.data[i])
+		}
+		a.data[i] = zero
+		a.valid[i] = false
+	}
+	for i := range a.keys {
+		a.keys[i] = -1
+	}
+}
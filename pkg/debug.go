@@ -8,7 +8,7 @@ import (
 )
 
 func (w *WavefrontComponent) String(score int) string {
-	traceback_str := []string{"OI", "EI", "OD", "ED", "SB", "IN", "DL", "EN"}
+	traceback_str := []string{"OI", "EI", "OD", "ED", "SB", "IN", "DL", "EN", "oi", "ei", "od", "ed", "in", "dl"} // lower case for the second piece
 	s := "<"
 	min_lo := math.MaxInt
 	max_hi := math.MinInt
@@ -46,7 +46,7 @@ func (w *WavefrontComponent) String(score int) string {
 		s = s + "["
 		lo, hi := UnpackWavefrontLoHi(w.W.Get(i).lohi)
 		for k := min_lo; k <= max_hi; k++ {
-			valid, val, _ := UnpackWavefrontValue(w.W.Get(i).Get(k))
+			valid, val, _ := w.W.Get(i).Get(k)
 			if valid {
 				s = s + fmt.Sprintf("%02d", val)
 			} else if k < lo || k > hi {
@@ -62,7 +62,7 @@ func (w *WavefrontComponent) String(score int) string {
 		s = s + "]\t["
 		// print out traceback matrix
 		for k := min_lo; k <= max_hi; k++ {
-			valid, _, tb := UnpackWavefrontValue(w.W.Get(i).Get(k))
+			valid, _, tb := w.W.Get(i).Get(k)
 			if valid {
 				s = s + traceback_str[tb]
 			} else if k < lo || k > hi {
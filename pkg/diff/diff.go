@@ -0,0 +1,204 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	wfa "wfa/pkg"
+)
+
+// Options: how two texts are compared and how much of them is shown around each change
+type Options struct {
+	Context          int  // lines of unchanged text kept before and after each change, changes at most twice as many lines apart share a hunk, see DefaultContext
+	IgnoreWhitespace bool // lines match when they only differ in their spaces, tabs and other whitespace, like diff -w
+}
+
+// DefaultContext: the context of diff -u
+const DefaultContext = 3
+
+// Line: a line of a hunk, Op is ' ' for context, '-' for a line only in text1 and '+' for a line only in text2
+// Text keeps its newline, which only the last line of a text may lack
+type Line struct {
+	Op    byte
+	Text  string // the line of text1, or of text2 for an added line
+	Text2 string // the line of text2 for a context line, which differs from Text when IgnoreWhitespace matched them
+}
+
+// Hunk: a run of changes with their context, covering Lines1 lines of text1 from line Begin1 and Lines2 lines of text2 from line Begin2, counted from 0
+type Hunk struct {
+	Begin1 int
+	Lines1 int
+	Begin2 int
+	Lines2 int
+	Lines  []Line
+}
+
+// edit: a line of the alignment, op is ' ', '-' or '+' as in Line, reached after aligning v lines of text1 and h lines of text2
+type edit struct {
+	op byte
+	v  int
+	h  int
+}
+
+// SplitLines: the lines of text with their newlines, the last one without it if text does not end with a newline
+func SplitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" { // text is empty or ends with a newline
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// key: what a line is compared by, without whitespace when ignoreWhitespace is set
+func key(line string, ignoreWhitespace bool) string {
+	if ignoreWhitespace {
+		return strings.Join(strings.Fields(line), "")
+	}
+	return line
+}
+
+// Diff: the hunks of changes which turn text1 into text2, with the fewest lines removed and added
+// the lines are aligned as tokens by the wavefront engine with DistanceIndel, and the errors are those of wfa.WFAlignTokens
+func Diff(text1 string, text2 string, options Options) ([]Hunk, error) {
+	lines1 := SplitLines(text1)
+	lines2 := SplitLines(text2)
+	keys1 := make([]string, len(lines1))
+	for i, line := range lines1 {
+		keys1[i] = key(line, options.IgnoreWhitespace)
+	}
+	keys2 := make([]string, len(lines2))
+	for i, line := range lines2 {
+		keys2[i] = key(line, options.IgnoreWhitespace)
+	}
+
+	result, err := wfa.WFAlignTokens(keys1, keys2, wfa.Penalty{}, true, wfa.Options{Memory: wfa.MemoryUltralow, Distance: wfa.DistanceIndel})
+	if err != nil {
+		return nil, err
+	}
+	return hunks(edits(result.CIGAR), lines1, lines2, max(options.Context, 0)), nil
+}
+
+// edits: the lines of the alignment of CIGAR, where M is an unchanged line, D a line of text1 removed, I a line of text2 added
+// and X a line replaced, and each run of changes lists its removed lines before its added ones as unified diffs do
+func edits(CIGAR string) []edit {
+	result := []edit{}
+	added := []edit{}
+	v, h := 0, 0
+	for _, op := range wfa.RunLengthDecode(CIGAR) {
+		switch op {
+		case 'M':
+			result = append(append(result, added...), edit{op: ' ', v: v, h: h})
+			added = added[:0]
+			v++
+			h++
+		case 'X':
+			result = append(result, edit{op: '-', v: v, h: h})
+			added = append(added, edit{op: '+', v: v, h: h})
+			v++
+			h++
+		case 'D':
+			result = append(result, edit{op: '-', v: v, h: h})
+			v++
+		case 'I':
+			added = append(added, edit{op: '+', v: v, h: h})
+			h++
+		}
+	}
+	return append(result, added...)
+}
+
+// hunks: groups the changes of edits with context lines around them, joining those at most 2*context lines apart
+func hunks(edits []edit, lines1 []string, lines2 []string, context int) []Hunk {
+	result := []Hunk{}
+	first, last := -1, -1 // the first and last change of the current hunk
+	for k, e := range edits {
+		if e.op == ' ' {
+			continue
+		}
+		if first >= 0 && k-last > 2*context+1 {
+			result = append(result, hunk(edits, lines1, lines2, max(first-context, 0), min(last+context+1, len(edits))))
+			first = -1
+		}
+		if first < 0 {
+			first = k
+		}
+		last = k
+	}
+	if first >= 0 {
+		result = append(result, hunk(edits, lines1, lines2, max(first-context, 0), min(last+context+1, len(edits))))
+	}
+	return result
+}
+
+// hunk: the hunk of edits[begin:end], which begins at the lowest lines of its edits since the added lines of a change were moved after its removed ones
+func hunk(edits []edit, lines1 []string, lines2 []string, begin int, end int) Hunk {
+	h := Hunk{Begin1: edits[begin].v, Begin2: edits[begin].h, Lines: make([]Line, 0, end-begin)}
+	for _, e := range edits[begin:end] {
+		h.Begin1 = min(h.Begin1, e.v)
+		h.Begin2 = min(h.Begin2, e.h)
+		switch e.op {
+		case ' ':
+			h.Lines = append(h.Lines, Line{Op: ' ', Text: lines1[e.v], Text2: lines2[e.h]})
+			h.Lines1++
+			h.Lines2++
+		case '-':
+			h.Lines = append(h.Lines, Line{Op: '-', Text: lines1[e.v]})
+			h.Lines1++
+		case '+':
+			h.Lines = append(h.Lines, Line{Op: '+', Text: lines2[e.h]})
+			h.Lines2++
+		}
+	}
+	return h
+}
+
+// String: the hunk in unified format, a header of its 1-based ranges followed by its lines
+// a context line is written from text1 as diff -w does, unless only one of its sides ends the text without a newline,
+// which a context line cannot show, so that it is written as the line of text1 removed and the line of text2 added
+func (h Hunk) String() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "@@ -%s +%s @@\n", unifiedRange(h.Begin1, h.Lines1), unifiedRange(h.Begin2, h.Lines2))
+	for _, line := range h.Lines {
+		if line.Op == ' ' && strings.HasSuffix(line.Text, "\n") != strings.HasSuffix(line.Text2, "\n") {
+			writeLine(&s, '-', line.Text)
+			writeLine(&s, '+', line.Text2)
+			continue
+		}
+		writeLine(&s, line.Op, line.Text)
+	}
+	return s.String()
+}
+
+// writeLine: text after op in unified format, followed by the marker of a missing newline at the end of the text
+func writeLine(s *strings.Builder, op byte, text string) {
+	s.WriteByte(op)
+	s.WriteString(text)
+	if !strings.HasSuffix(text, "\n") {
+		s.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// unifiedRange: the range of count lines from begin as diff -u writes it, the line before an empty range and no count for a single line
+func unifiedRange(begin int, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", begin)
+	case 1:
+		return fmt.Sprintf("%d", begin+1)
+	default:
+		return fmt.Sprintf("%d,%d", begin+1, count)
+	}
+}
+
+// Unified: the unified diff turning text1, named name1, into text2, named name2, empty when they have no changes
+func Unified(name1 string, name2 string, text1 string, text2 string, options Options) (string, error) {
+	hunks, err := Diff(text1, text2, options)
+	if err != nil || len(hunks) == 0 {
+		return "", err
+	}
+	var s strings.Builder
+	fmt.Fprintf(&s, "--- %s\n+++ %s\n", name1, name2)
+	for _, h := range hunks {
+		s.WriteString(h.String())
+	}
+	return s.String(), nil
+}
@@ -0,0 +1,208 @@
+package wfa
+
+import (
+	"math/bits"
+	"strings"
+)
+
+// DNA: a nucleotide sequence packed 2 bits per base, 32 bases to a word, with A=0, C=1, G=2 and T=3
+// bases other than A, C, G and T are ambiguous, they are marked in a mask, packed as A and decode to N, so that like the N of a string
+// an ambiguous base matches another ambiguous base and nothing else
+// a DNA is a view of its words like a string is of its bytes, slicing shares them
+type DNA struct {
+	words     []uint64 // base i at bits 2*(i%32) of words[i/32], followed by a zero word so that any 32 bases are read from two words
+	ambiguous []uint64 // bit i%64 of ambiguous[i/64] marks base i, followed by a zero word, nil without ambiguous bases
+	start     int      // first base of the view
+	n         int      // number of bases of the view
+}
+
+// dnaCodes: 2-bit code of each byte, 4 for an ambiguous one
+var dnaCodes = func() [256]uint8 {
+	var codes [256]uint8
+	for i := range codes {
+		codes[i] = 4
+	}
+	for code, base := range "ACGT" {
+		codes[base] = uint8(code)
+		codes[base-'A'+'a'] = uint8(code)
+	}
+	return codes
+}()
+
+// EncodeDNA: packs s, where a, c, g and t encode as A, C, G and T and every other byte as an ambiguous base
+func EncodeDNA(s string) DNA {
+	d := newDNA(len(s))
+	for i := 0; i < len(s); i++ {
+		code := dnaCodes[s[i]]
+		if code == 4 {
+			d.setAmbiguous(i)
+			continue
+		}
+		d.words[i/32] |= uint64(code) << (2 * (i % 32))
+	}
+	return d
+}
+
+// newDNA: returns n bases of A without ambiguous ones
+func newDNA(n int) DNA {
+	return DNA{words: make([]uint64, (n+31)/32+1), n: n}
+}
+
+// setAmbiguous: marks base i of a DNA which is not a view, allocating the mask on the first ambiguous base
+func (d *DNA) setAmbiguous(i int) {
+	if d.ambiguous == nil {
+		d.ambiguous = make([]uint64, (d.n+63)/64+1)
+	}
+	d.ambiguous[i/64] |= 1 << (i % 64)
+}
+
+// Len: the number of bases
+func (d DNA) Len() int {
+	return d.n
+}
+
+// code: the 2-bit code of base i, and whether it is ambiguous
+func (d DNA) code(i int) (uint8, bool) {
+	p := d.start + i
+	ambiguous := d.ambiguous != nil && d.ambiguous[p/64]>>(p%64)&1 != 0
+	return uint8(d.words[p/32] >> (2 * (p % 32)) & 3), ambiguous
+}
+
+// Base: base i as A, C, G, T or N for an ambiguous one
+func (d DNA) Base(i int) byte {
+	code, ambiguous := d.code(i)
+	if ambiguous {
+		return 'N'
+	}
+	return "ACGT"[code]
+}
+
+// Ambiguous: whether base i is ambiguous
+func (d DNA) Ambiguous(i int) bool {
+	_, ambiguous := d.code(i)
+	return ambiguous
+}
+
+// Decode: the bases as a string of A, C, G, T and N
+func (d DNA) Decode() string {
+	var s strings.Builder
+	s.Grow(d.n)
+	for i := 0; i < d.n; i++ {
+		s.WriteByte(d.Base(i))
+	}
+	return s.String()
+}
+
+// String: same as Decode
+func (d DNA) String() string {
+	return d.Decode()
+}
+
+// Slice: the bases i..j-1, sharing the words of d
+func (d DNA) Slice(i int, j int) DNA {
+	if i < 0 || i > j || j > d.n {
+		panic("wfa: DNA slice bounds out of range")
+	}
+	d.start = d.start + i
+	d.n = j - i
+	return d
+}
+
+// ReverseComplement: the bases in reverse order with A and T, C and G swapped, ambiguous bases stay ambiguous
+func (d DNA) ReverseComplement() DNA {
+	return d.reverse(3)
+}
+
+// reverse: the bases in reverse order with their codes xor complement, 0 to only reverse them
+func (d DNA) reverse(complement uint8) DNA {
+	r := newDNA(d.n)
+	for i := 0; i < d.n; i++ {
+		code, ambiguous := d.code(d.n - 1 - i)
+		if ambiguous {
+			r.setAmbiguous(i)
+			continue
+		}
+		r.words[i/32] |= uint64(code^complement) << (2 * (i % 32))
+	}
+	return r
+}
+
+// dnaWord: the 32 bases of words from base 32*i + shift/2, the first in the lowest bits
+func dnaWord(words []uint64, i uint, shift uint) uint64 {
+	return words[i]>>(shift&63) | words[i+1]<<1<<((63-shift)&63) // with a shift of 0 nothing is taken from words[i+1]
+}
+
+// dnaMatches: the number of bases in common of words1 from base p1 and words2 from base p2, at most limit
+func dnaMatches(words1 []uint64, p1 uint, words2 []uint64, p2 uint, limit int) int {
+	i1, shift1 := p1/32, 2*(p1%32)
+	i2, shift2 := p2/32, 2*(p2%32)
+	for matches := 0; matches < limit; matches = matches + 32 {
+		if x := dnaWord(words1, i1, shift1) ^ dnaWord(words2, i2, shift2); x != 0 {
+			x = (x | x>>1) & 0x5555_5555_5555_5555 // the low bit of each base which differs
+			return min(matches+bits.TrailingZeros64(x)/2, limit)
+		}
+		i1++
+		i2++
+	}
+	return limit
+}
+
+// dnaMask: the ambiguous marks of the 32 bases of ambiguous from base p, base p in the lowest bit
+func dnaMask(ambiguous []uint64, p uint) uint32 {
+	if ambiguous == nil {
+		return 0
+	}
+	s := p % 64
+	return uint32(ambiguous[p/64]>>s | ambiguous[p/64+1]<<(64-s))
+}
+
+// dnaPair: Sequences of two DNA compared 32 bases at a time
+type dnaPair struct {
+	s1 DNA
+	s2 DNA
+}
+
+// DNASequences: the Sequences to align s1 with s2
+func DNASequences(s1 DNA, s2 DNA) Sequences {
+	return &dnaPair{s1: s1, s2: s2}
+}
+
+func (p *dnaPair) Lens() (int, int) {
+	return p.s1.n, p.s2.n
+}
+
+// Matches: the bases in common, found from the trailing zeros of the xor of 32 bases of each
+// and when there are ambiguous bases, of the xor of their marks
+func (p *dnaPair) Matches(v int, h int) int {
+	limit := min(p.s1.n-v, p.s2.n-h)
+	if limit <= 0 {
+		return 0
+	}
+	p1 := uint(p.s1.start + v)
+	p2 := uint(p.s2.start + h)
+	if p.s1.ambiguous == nil && p.s2.ambiguous == nil {
+		return dnaMatches(p.s1.words, p1, p.s2.words, p2, limit)
+	}
+
+	for matches := 0; matches < limit; matches = matches + 32 {
+		// bases matching up to the first differing mark differ where their codes do
+		first := bits.TrailingZeros32(dnaMask(p.s1.ambiguous, p1) ^ dnaMask(p.s2.ambiguous, p2))
+		if first < 32 {
+			return matches + dnaMatches(p.s1.words, p1, p.s2.words, p2, min(first, limit-matches))
+		}
+		if same := dnaMatches(p.s1.words, p1, p.s2.words, p2, min(32, limit-matches)); same < 32 {
+			return matches + same
+		}
+		p1 = p1 + 32
+		p2 = p2 + 32
+	}
+	return limit
+}
+
+func (p *dnaPair) Slice(v_begin int, v_end int, h_begin int, h_end int) Sequences {
+	return &dnaPair{s1: p.s1.Slice(v_begin, v_end), s2: p.s2.Slice(h_begin, h_end)}
+}
+
+func (p *dnaPair) Reverse() Sequences {
+	return &dnaPair{s1: p.s1.reverse(0), s2: p.s2.reverse(0)}
+}
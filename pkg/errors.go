@@ -0,0 +1,67 @@
+package wfa
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxSequenceLength: longest sequence which can be aligned, the offsets of a Wavefront widen from uint32 to uint64 and fit any length,
+// so the bound leaves 4 bits of an int for the anti-diagonals v+h and the scores, which are computed from n+m
+const MaxSequenceLength = 1<<59 - 1
+
+var (
+	ErrInvalidPenalty  = errors.New("wfa: invalid penalty")   // the penalties break an assumption of the wavefront recurrences
+	ErrInvalidOptions  = errors.New("wfa: invalid options")   // an option is out of its range
+	ErrSequenceTooLong = errors.New("wfa: sequence too long") // a sequence is longer than MaxSequenceLength
+)
+
+// Validate: checks that sequences of length n and m can be aligned with penalties and options, returning an error wrapping
+// ErrInvalidPenalty, ErrInvalidOptions or ErrSequenceTooLong if not
+// mismatches and gap extensions have to cost more than a match, otherwise the translated penalties would not advance the score,
+// and gap opens cannot be negative, the penalties a distance ignores are not checked
+func Validate(n int, m int, penalties Penalty, options Options) error {
+	if uint64(n) > MaxSequenceLength || uint64(m) > MaxSequenceLength {
+		return fmt.Errorf("%w: lengths %d and %d, at most %d is supported", ErrSequenceTooLong, n, m, MaxSequenceLength)
+	}
+
+	if options.Memory > MemoryUltralow {
+		return fmt.Errorf("%w: unknown memory mode %d", ErrInvalidOptions, options.Memory)
+	}
+	if options.Span > SpanLocal {
+		return fmt.Errorf("%w: unknown span %d", ErrInvalidOptions, options.Span)
+	}
+	if options.Distance > DistanceIndel {
+		return fmt.Errorf("%w: unknown distance %d", ErrInvalidOptions, options.Distance)
+	}
+	if r := options.Heuristic.Reduction; r != nil && (r.MinWavefrontLength < 0 || r.MaxDistance < 0 || r.Steps < 1) {
+		return fmt.Errorf("%w: reduction %+v needs a positive Steps and nonnegative MinWavefrontLength, MaxDistance", ErrInvalidOptions, *r)
+	}
+	if options.Heuristic.XDrop < 0 || options.Heuristic.ZDrop < 0 {
+		return fmt.Errorf("%w: XDrop %d and ZDrop %d cannot be negative", ErrInvalidOptions, options.Heuristic.XDrop, options.Heuristic.ZDrop)
+	}
+
+	if options.Distance == DistanceEdit || options.Distance == DistanceIndel { // the penalties are not used
+		return nil
+	}
+	if penalties.M >= penalties.X {
+		return fmt.Errorf("%w: M = %d has to be less than X = %d", ErrInvalidPenalty, penalties.M, penalties.X)
+	}
+	if penalties.M >= 2*penalties.E {
+		return fmt.Errorf("%w: M = %d has to be less than 2E = %d", ErrInvalidPenalty, penalties.M, 2*penalties.E)
+	}
+	if options.Distance != DistanceGapLinear && penalties.O < 0 {
+		return fmt.Errorf("%w: O = %d cannot be negative", ErrInvalidPenalty, penalties.O)
+	}
+	if options.Distance == DistanceGapAffine2p {
+		if penalties.M >= 2*penalties.E2 {
+			return fmt.Errorf("%w: M = %d has to be less than 2E2 = %d", ErrInvalidPenalty, penalties.M, 2*penalties.E2)
+		}
+		if penalties.O2 < 0 {
+			return fmt.Errorf("%w: O2 = %d cannot be negative", ErrInvalidPenalty, penalties.O2)
+		}
+	}
+	if options.Span == SpanEndsFree && !options.Heuristic.Extension() && penalties.M > 0 {
+		return fmt.Errorf("%w: M = %d cannot be positive for ends-free alignment, where skipping a character would beat aligning it", ErrInvalidPenalty, penalties.M)
+	}
+	return nil
+}
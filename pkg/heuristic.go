@@ -0,0 +1,185 @@
+package wfa
+
+// ReduceState: the scratch space of the adaptive reduction, reused by every wavefront of an alignment
+type ReduceState struct {
+	distances []int // distance to the end of each diagonal of the wavefront being reduced
+}
+
+// WFReduce: applies the adaptive reduction to wavefront=score of an alignment of n, m characters, trimming every component to the kept diagonals
+// the distance of an offset to the end is the larger of the characters left in s1 and s2, returns whether any valid offset was dropped
+// the diagonals of the end and of the free ends are never dropped, so that the alignment can still finish
+func WFReduce(components []*WavefrontComponent, score int, n int, m int, free EndsFree, reduction Reduction, state *ReduceState) bool {
+	M := components[ComponentM]
+	if score%max(reduction.Steps, 1) != 0 {
+		return false
+	}
+	ok, lo, hi := M.GetLoHi(score)
+	if !ok || hi-lo+1 < reduction.MinWavefrontLength {
+		return false
+	}
+
+	// a diagonal is as far as the closest of its components, diagonals where none is valid hold nothing to lose
+	// and cells outside of s1, s2 can never be part of an alignment
+	if cap(state.distances) < hi-lo+1 {
+		state.distances = make([]int, hi-lo+1)
+	}
+	distances := state.distances[:hi-lo+1]
+	min_distance := MaxInt
+	for k := lo; k <= hi; k++ {
+		distances[k-lo] = MaxInt
+		for _, component := range components {
+			ok, uh := component.GetOffset(score, k)
+			h := int(uh)
+			v := h - k
+			if !ok || h > m || v > n {
+				continue
+			}
+			distances[k-lo] = min(distances[k-lo], max(n-v, m-h))
+		}
+		min_distance = min(min_distance, distances[k-lo])
+	}
+	if min_distance == MaxInt { // nothing to compare against
+		return false
+	}
+
+	// only the outer diagonals are dropped so that the wavefront stays contiguous
+	keep_lo := m - n - free.S2End // ends at (n, m-S2End)
+	keep_hi := m - n + free.S1End // ends at (n-S1End, m)
+	dropped := false
+	new_lo := lo
+	for new_lo < min(keep_lo, hi) && distances[new_lo-lo]-min_distance > reduction.MaxDistance {
+		dropped = dropped || distances[new_lo-lo] != MaxInt
+		new_lo++
+	}
+	new_hi := hi
+	for new_hi > max(keep_hi, new_lo) && distances[new_hi-lo]-min_distance > reduction.MaxDistance {
+		dropped = dropped || distances[new_hi-lo] != MaxInt
+		new_hi--
+	}
+
+	if new_lo != lo || new_hi != hi {
+		for _, component := range components {
+			component.TrimLoHi(score, new_lo, new_hi)
+		}
+	}
+	return dropped
+}
+
+// DropState: the best scoring prefix alignment seen by the X-drop and Z-drop
+type DropState struct {
+	Score          int // best score in the caller's penalties
+	WavefrontScore int // wavefront where it was reached
+	K              int
+	Offset         int
+	Alive          int  // last wavefront which kept any diagonal
+	Dropped        bool // the heuristics dropped or stopped before running out of diagonals
+
+	// best score and diagonal of each of the last wavefronts, which the next ones are computed from
+	recentScores []int
+	recentKs     []int
+	scores       []int // score of each diagonal of the wavefront being dropped
+}
+
+// NewDropState: returns the state before the initial wavefront at score, window is the number of wavefronts the next one is computed from
+func NewDropState(score int, window int) DropState {
+	state := DropState{
+		Score:          MaxInt,
+		WavefrontScore: score,
+		Alive:          score,
+		recentScores:   make([]int, window),
+		recentKs:       make([]int, window),
+	}
+	for i := range state.recentScores {
+		state.recentScores[i] = MaxInt
+	}
+	return state
+}
+
+// WFDrop: applies the X-drop and Z-drop to wavefront=score of an extension of s1, s2 with n, m characters, updating the best prefix alignment in state
+// scores are compared in the caller's penalties, where a cell on diagonal k at offset h scores p.Score(score, 2h-k), returns whether to stop
+// the Z-drop compares against the best of the last wavefronts since the ones in between score changes only hold the cells lagging behind
+func WFDrop(components []*WavefrontComponent, score int, n int, m int, p WFPenalties, heuristic Heuristic, state *DropState) bool {
+	M := components[ComponentM]
+	window := len(state.recentScores)
+	state.recentScores[score%window] = MaxInt
+	ok, lo, hi := M.GetLoHi(score)
+	if !ok {
+		return score-state.Alive >= window // no later wavefront can be computed from the remaining ones
+	}
+
+	// cells outside of s1, s2 can never be part of an alignment
+	if cap(state.scores) < hi-lo+1 {
+		state.scores = make([]int, hi-lo+1)
+	}
+	scores := state.scores[:hi-lo+1]
+	cur_best := MaxInt
+	cur_k := 0
+	for k := lo; k <= hi; k++ {
+		scores[k-lo] = MaxInt
+		ok, uh := M.GetOffset(score, k)
+		h := int(uh)
+		v := h - k
+		if !ok || h > m || v > n {
+			continue
+		}
+		scores[k-lo] = p.Score(score, h+v)
+		if scores[k-lo] < cur_best {
+			cur_best = scores[k-lo]
+			cur_k = k
+		}
+		if scores[k-lo] < state.Score {
+			state.Score = scores[k-lo]
+			state.WavefrontScore = score
+			state.K = k
+			state.Offset = h
+		}
+	}
+
+	state.recentScores[score%window] = cur_best
+	state.recentKs[score%window] = cur_k
+	if heuristic.ZDrop > 0 {
+		recent_best := MaxInt
+		recent_k := 0
+		for i, recent := range state.recentScores {
+			if recent < recent_best {
+				recent_best = recent
+				recent_k = state.recentKs[i]
+			}
+		}
+		e := p.Score(p.E, 1) // gap extend in the caller's penalties
+		if recent_best != MaxInt && recent_best-state.Score > heuristic.ZDrop+e*max(recent_k-state.K, state.K-recent_k) {
+			state.Dropped = true
+			return true
+		}
+	}
+
+	// only the outer diagonals are dropped so that the wavefront stays contiguous
+	threshold := MaxInt - 1 // without the X-drop, only cells outside of s1, s2 are dropped
+	if heuristic.XDrop > 0 {
+		threshold = state.Score + heuristic.XDrop
+	}
+	new_lo := lo
+	for new_lo <= hi && scores[new_lo-lo] > threshold {
+		state.Dropped = state.Dropped || scores[new_lo-lo] != MaxInt
+		new_lo++
+	}
+	new_hi := hi
+	for new_hi >= new_lo && scores[new_hi-lo] > threshold {
+		state.Dropped = state.Dropped || scores[new_hi-lo] != MaxInt
+		new_hi--
+	}
+
+	if new_lo > new_hi {
+		for _, component := range components {
+			component.W.Unset(score)
+		}
+		return score-state.Alive >= window
+	}
+	if new_lo != lo || new_hi != hi {
+		for _, component := range components {
+			component.TrimLoHi(score, new_lo, new_hi)
+		}
+	}
+	state.Alive = score
+	return false
+}
@@ -0,0 +1,34 @@
+package tabular
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writer: writes lines of tab separated fields, buffering them until Flush
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter: returns a Writer writing to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteLine: writes fields separated by tabs and ended by a newline
+func (w *Writer) WriteLine(fields []string) error {
+	_, err := w.w.WriteString(strings.Join(fields, "\t") + "\n")
+	return err
+}
+
+// Flush: writes the buffered lines to the underlying writer
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// AS: the AS:i tag of an alignment scoring score, negated so that higher is better as SAM and PAF consumers expect
+func AS(score int) string {
+	return "AS:i:" + strconv.Itoa(-score)
+}
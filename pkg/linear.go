@@ -0,0 +1,126 @@
+package wfa
+
+import "strings"
+
+// set the next lo and hi bounds for the single component M of a linear distance
+func NextLoHiLinear(M *WavefrontComponent, score int, penalties Penalty, distance Distance) (int, int) {
+	x := penalties.X
+	e := penalties.E
+
+	a_ok, a_lo, a_hi := M.GetLoHi(score - x)
+	b_ok, b_lo, b_hi := M.GetLoHi(score - e)
+	if distance == DistanceIndel { // no mismatches, only gaps lead to the next wavefront
+		a_ok = false
+	}
+
+	ok_lo, idx := SafeArgMin(
+		[]bool{a_ok, b_ok},
+		[]int{a_lo, b_lo},
+	)
+	lo := SafeMin([]int{a_lo, b_lo}, idx) - 1
+
+	ok_hi, idx := SafeArgMax(
+		[]bool{a_ok, b_ok},
+		[]int{a_hi, b_hi},
+	)
+	hi := SafeMax([]int{a_hi, b_hi}, idx) + 1
+
+	if ok_lo && ok_hi {
+		M.SetLoHi(score, lo, hi)
+	}
+	return lo, hi
+}
+
+// set the traceback and diag value for the next M wavefront of a linear distance, from a mismatch on M at score-x or a gap from M at score-e
+// Ins and Del record a gap from M at score-e rather than a step from the I and D components
+func NextMLinear(M_sub *Wavefront, M_gap *Wavefront, M *Wavefront, k int, distance Distance) {
+	a_ok, a := M_sub.Offset(k)
+	a++ // important to have +1 here
+	if distance == DistanceIndel {
+		a_ok = false
+	}
+	b_ok, b := M_gap.Offset(k - 1)
+	b++ // an insertion consumes s2
+	c_ok, c := M_gap.Offset(k + 1)
+
+	ok, nextMTraceback := SafeArgMax([]bool{a_ok, b_ok, c_ok}, []uint64{a, b, c})
+	nextMVal := SafeMax([]uint64{a, b, c}, nextMTraceback)
+	if ok {
+		M.Set(k, nextMVal, []Traceback{Sub, Ins, Del}[nextMTraceback])
+	}
+}
+
+func WFNextLinear(M *WavefrontComponent, score int, penalties Penalty, distance Distance) {
+	// get this score's lo, hi
+	lo, hi := NextLoHiLinear(M, score, penalties, distance)
+
+	// the wavefronts read and written are looked up once rather than for each diagonal
+	M_sub, M_gap, M_next := M.W.Get(score-penalties.X), M.W.Get(score-penalties.E), M.W.Get(score)
+
+	for k := lo; k <= hi; k++ { // for each diagonal, extend the matrix for the next wavefront
+		NextMLinear(M_sub, M_gap, M_next, k, distance)
+	}
+}
+
+// WFBacktraceLinear: walks the tracebacks of a linear distance from wavefront=score, diag=A_k back to the initial wavefront and returns the CIGAR
+func WFBacktraceLinear(M *WavefrontComponent, score int, penalties Penalty, A_k int) string {
+	x := penalties.X
+	e := penalties.E
+
+	tb_s := score
+	tb_k := A_k
+	done := false
+
+	_, current_dist, current_traceback := M.GetVal(tb_s, tb_k)
+
+	Ops := []rune{'~'}
+	Counts := []uint{0}
+
+	for !done {
+		switch current_traceback {
+		case Sub:
+			tb_s = tb_s - x
+			// tb_k = tb_k;
+			_, next_dist, next_traceback := M.GetVal(tb_s, tb_k)
+
+			Ops, Counts = AppendOp(Ops, Counts, 'M', uint(current_dist-next_dist)-1)
+			Ops, Counts = AppendOp(Ops, Counts, 'X', 1)
+
+			current_dist = next_dist
+			current_traceback = next_traceback
+		case Ins:
+			tb_s = tb_s - e
+			tb_k = tb_k - 1
+			_, next_dist, next_traceback := M.GetVal(tb_s, tb_k)
+
+			Ops, Counts = AppendOp(Ops, Counts, 'M', uint(current_dist-next_dist)-1)
+			Ops, Counts = AppendOp(Ops, Counts, 'I', 1)
+
+			current_dist = next_dist
+			current_traceback = next_traceback
+		case Del:
+			tb_s = tb_s - e
+			tb_k = tb_k + 1
+			_, next_dist, next_traceback := M.GetVal(tb_s, tb_k)
+
+			Ops, Counts = AppendOp(Ops, Counts, 'M', uint(current_dist-next_dist))
+			Ops, Counts = AppendOp(Ops, Counts, 'D', 1)
+
+			current_dist = next_dist
+			current_traceback = next_traceback
+		case End:
+			// the initial wavefront starts diagonals above 0 at offset k
+			Ops, Counts = AppendOp(Ops, Counts, 'M', uint(current_dist)-uint(max(tb_k, 0)))
+
+			done = true
+		}
+	}
+
+	var CIGAR strings.Builder
+	for i := len(Ops) - 1; i > 0; i-- {
+		CIGAR.WriteString(UIntToString(Counts[i]))
+		CIGAR.WriteRune(Ops[i])
+	}
+
+	return CIGAR.String()
+}
@@ -0,0 +1,126 @@
+package wfa
+
+import "context"
+
+// wfLocal: local alignment of seqs under translated penalties p with a skip cost, which is positive given a match bonus
+// leaving a character unaligned costs p.Skip wherever it is, so the best local alignment has the lowest total score after paying skip for every unaligned character
+// a forward pass with starting points on every diagonal finds where the best local alignment ends,
+// a reverse pass from that end finds where it begins, and the region in between is aligned end-to-end for the CIGAR
+// returns the total translated score, which includes the skip of the unaligned characters
+func wfLocal(ctx context.Context, seqs Sequences, p WFPenalties, doCIGAR bool, memory MemoryMode, pool *WavefrontPool) Result {
+	n, m := seqs.Lens()
+	best, best_k, best_h := wfLocalEnd(ctx, seqs, p, true, pool)
+	v_end := best_h - best_k
+	h_end := best_h
+	if !doCIGAR { // the begin is only known after the reverse pass
+		return Result{
+			Score:   best,
+			S1Begin: -1,
+			S1End:   v_end,
+			S2Begin: -1,
+			S2End:   h_end,
+		}
+	}
+
+	// the best alignment of prefixes of the reversed prefixes begins the best local alignment
+	_, start_k, start_h := wfLocalEnd(ctx, seqs.Slice(0, v_end, 0, h_end).Reverse(), p, false, pool)
+	v_begin := v_end - (start_h - start_k)
+	h_begin := h_end - start_h
+
+	var result Result
+	if memory == MemoryUltralow {
+		result = BiWFAlign(ctx, seqs.Slice(v_begin, v_end, h_begin, h_end), p, Heuristic{}, MaxInt, true, EndsFree{}, pool)
+	} else {
+		result = wfAlign(ctx, seqs.Slice(v_begin, v_end, h_begin, h_end), p, Heuristic{}, MaxInt, true, ComponentM, ComponentM, EndsFree{}, pool)
+	}
+	result.Score = result.Score + p.Skip*(n-(v_end-v_begin)+m-(h_end-h_begin))
+	result.S1Begin = v_begin
+	result.S1End = v_end
+	result.S2Begin = h_begin
+	result.S2End = h_end
+	return result
+}
+
+// wfLocalEnd: finds the cell ending the alignment with the lowest total score after paying p.Skip for every unaligned character, keeping only the last wavefronts in rings
+// the alignment begins at the start of s1, s2 unless anywhere is set, returns the total, diagonal and offset
+func wfLocalEnd(ctx context.Context, seqs Sequences, p WFPenalties, anywhere bool, pool *WavefrontPool) (int, int, int) {
+	n, m := seqs.Lens()
+	keep := p.MaxStep() + 1
+	M := pool.Component(keep)
+	I := pool.Component(keep)
+	D := pool.Component(keep)
+	I2 := pool.Component(keep)
+	D2 := pool.Component(keep)
+	defer pool.Release(M, I, D, I2, D2)
+	score := WFInit(M, I, D, I2, D2, ComponentM, EndsFree{}, p.Skip, p.Penalty)
+	best := MaxInt // lowest total score of a local alignment
+	best_k := 0
+	best_h := 0
+
+	for {
+		WFExtend(ctx, M, seqs, score)
+		ok, k, h, total := WFLocalReached(M, score, n, m, p.Skip)
+		if ok && total < best {
+			best = total
+			best_k = k
+			best_h = h
+		}
+		if best <= score { // exit when no later wavefront can end a local alignment for less
+			break
+		}
+		score = score + 1
+		wfNext(M, I, D, I2, D2, score, p)
+		if anywhere {
+			WFLocalSources(M, score, n, m, p.Skip)
+		}
+	}
+
+	return best, best_k, best_h
+}
+
+// WFLocalSources: adds the cells which cost score to reach by skipping the characters before them as starting points of wavefront=score
+// every cell of the anti-diagonal is seeded since any one followed by matches may begin the best alignment, O(min(n, m)) per call,
+// and up to O(n·m) over an alignment of dissimilar sequences, whose wavefronts reach every anti-diagonal
+func WFLocalSources(M *WavefrontComponent, score int, n int, m int, skip int) {
+	if skip == 0 || score%skip != 0 {
+		return
+	}
+	d := score / skip // characters skipped before the cell, v + h = d
+	h_min := max(d-n, 0)
+	h_max := min(d, m)
+	if h_min > h_max {
+		return
+	}
+	// set the outermost diagonals first so that the wavefront grows at most twice
+	M.SetSource(score, 2*h_min-d, uint64(h_min))
+	M.SetSource(score, 2*h_max-d, uint64(h_max))
+	for h := h_min + 1; h < h_max; h++ {
+		M.SetSource(score, 2*h-d, uint64(h))
+	}
+}
+
+// WFLocalReached: finds the cell in wavefront=score with the lowest total score after paying skip for each character after it
+// returning its diagonal, offset and total
+func WFLocalReached(M *WavefrontComponent, score int, n int, m int, skip int) (bool, int, int, int) {
+	found := false
+	best_k := 0
+	best_h := 0
+	best := MaxInt
+	_, lo, hi := M.GetLoHi(score)
+	for k := lo; k <= hi; k++ {
+		ok, uh := M.GetOffset(score, k)
+		h := int(uh)
+		v := h - k
+		if !ok || h > m || v > n {
+			continue
+		}
+		total := score + skip*(n-v+m-h)
+		if total < best {
+			found = true
+			best_k = k
+			best_h = h
+			best = total
+		}
+	}
+	return found, best_k, best_h, best
+}
@@ -0,0 +1,165 @@
+package paf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	wfa "wfa/pkg"
+	"wfa/pkg/cigar"
+	"wfa/pkg/internal/tabular"
+)
+
+var (
+	ErrNoCIGAR       = cigar.ErrNoCIGAR                         // the result was aligned without doCIGAR, so it has no coordinates or tags
+	ErrUnaligned     = errors.New("paf: result aligns nothing") // the result is not StatusOK or is empty, which PAF has no line for
+	ErrInvalidRecord = errors.New("paf: invalid record field")  // a field cannot be written without breaking the line into more or fewer fields
+)
+
+// Options: the flavors of the cg:Z and cs:Z tags
+type Options struct {
+	Extended bool // cg:Z with = and X like minimap2 --eqx, instead of M for both
+	LongCS   bool // cs:Z with the matching sequence as =ACGT like minimap2 --cs=long, instead of its length as :4
+}
+
+// Record: a line of PAF, where the target is s1 and the query s2 of the alignment, with coordinates from 0 and exclusive ends
+type Record struct {
+	QName    string
+	QLen     int
+	QStart   int // on the query as given, even when it was aligned as its reverse complement
+	QEnd     int
+	Strand   byte // + or -
+	TName    string
+	TLen     int
+	TStart   int
+	TEnd     int
+	Matches  int // residue matches
+	BlockLen int // alignment columns, matches, mismatches and gaps
+	MapQ     int // 255 when unavailable
+	Tags     []string
+}
+
+// NewRecord: the record of query, named qname, aligned with target, named tname, by result, with NM:i, AS:i, cg:Z and cs:Z tags
+// when reverse is set, query is the reverse complement of the read which was aligned, and the query coordinates are mapped back to the read
+// a result which is not StatusOK or aligns nothing returns an error wrapping ErrUnaligned, one without CIGAR one wrapping ErrNoCIGAR,
+// and one whose coordinates or CIGAR do not fit target and query one wrapping cigar.ErrMismatch
+func NewRecord(qname string, tname string, target string, query string, result wfa.Result, reverse bool, options Options) (Record, error) {
+	aligned, err := cigar.FromResult(result, target, query)
+	if err != nil {
+		return Record{}, err
+	}
+	if len(aligned) == 0 {
+		return Record{}, fmt.Errorf("%w: status %s, CIGAR %q", ErrUnaligned, result.Status, result.CIGAR)
+	}
+	t := target[result.S1Begin:result.S1End]
+	q := query[result.S2Begin:result.S2End]
+
+	alignment := result.Alignment()
+	record := Record{
+		QName:    qname,
+		QLen:     len(query),
+		QStart:   result.S2Begin,
+		QEnd:     result.S2End,
+		Strand:   '+',
+		TName:    tname,
+		TLen:     len(target),
+		TStart:   result.S1Begin,
+		TEnd:     result.S1End,
+		Matches:  alignment.Matches,
+		BlockLen: alignment.Matches + alignment.Mismatches + alignment.Insertions + alignment.Deletions,
+		MapQ:     255,
+	}
+	if reverse {
+		record.Strand = '-'
+		record.QStart = len(query) - result.S2End
+		record.QEnd = len(query) - result.S2Begin
+	}
+	cg := aligned.Collapse()
+	if options.Extended {
+		cg = aligned.Extended()
+	}
+	record.Tags = []string{
+		"NM:i:" + strconv.Itoa(alignment.Mismatches+alignment.Insertions+alignment.Deletions),
+		tabular.AS(result.Score),
+		"cg:Z:" + cg.String(),
+		"cs:Z:" + CS(aligned, t, q, options.LongCS),
+	}
+	return record, nil
+}
+
+// CS: the cs:Z difference string of the alignment of c of target with query, :n for n matches or =ACGT with long,
+// *tq for a mismatch of t in the target with q in the query, +acgt for an insertion of the query and -acgt for a deletion of the target
+// M is a match as in the CIGARs of the wfa package, an M-only CIGAR has to be expanded first
+func CS(c cigar.CIGAR, target string, query string, long bool) string {
+	var cs strings.Builder
+	v, h := 0, 0
+	for _, run := range c.Merge() {
+		switch run.Op {
+		case wfa.OpMatch, cigar.OpEqual:
+			if long {
+				cs.WriteString("=" + target[v:v+run.Length])
+			} else {
+				cs.WriteString(":" + strconv.Itoa(run.Length))
+			}
+			v = v + run.Length
+			h = h + run.Length
+		case wfa.OpMismatch:
+			for j := 0; j < run.Length; j++ {
+				cs.WriteString("*" + strings.ToLower(target[v+j:v+j+1]+query[h+j:h+j+1]))
+			}
+			v = v + run.Length
+			h = h + run.Length
+		case wfa.OpInsertion:
+			cs.WriteString("+" + strings.ToLower(query[h:h+run.Length]))
+			h = h + run.Length
+		case wfa.OpDeletion:
+			cs.WriteString("-" + strings.ToLower(target[v:v+run.Length]))
+			v = v + run.Length
+		}
+	}
+	return cs.String()
+}
+
+// Writer: writes records in PAF, buffering them until Flush
+type Writer struct {
+	w *tabular.Writer
+}
+
+// NewWriter: returns a Writer writing to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: tabular.NewWriter(w)}
+}
+
+// Write: writes record as a line of tab separated fields, returning an error wrapping ErrInvalidRecord
+// if a name is empty or holds whitespace, or the strand is not + or -
+func (w *Writer) Write(record Record) error {
+	for _, name := range []string{record.QName, record.TName} {
+		if name == "" || strings.ContainsAny(name, " \t\n\r") {
+			return fmt.Errorf("%w: name %q must be nonempty and without whitespace", ErrInvalidRecord, name)
+		}
+	}
+	if record.Strand != '+' && record.Strand != '-' {
+		return fmt.Errorf("%w: strand %q is not + or -", ErrInvalidRecord, record.Strand)
+	}
+	fields := []string{
+		record.QName,
+		strconv.Itoa(record.QLen),
+		strconv.Itoa(record.QStart),
+		strconv.Itoa(record.QEnd),
+		string(record.Strand),
+		record.TName,
+		strconv.Itoa(record.TLen),
+		strconv.Itoa(record.TStart),
+		strconv.Itoa(record.TEnd),
+		strconv.Itoa(record.Matches),
+		strconv.Itoa(record.BlockLen),
+		strconv.Itoa(record.MapQ),
+	}
+	return w.w.WriteLine(append(fields, record.Tags...))
+}
+
+// Flush: writes the buffered lines to the underlying writer
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,134 @@
+package wfa
+
+// WFPenalties: penalties translated into an equivalent system with a zero match penalty, which the wavefront recurrences require
+// a match penalty M is removed by doubling the other penalties since 2*score = M*(n+m) + 2(X-M)*mismatches + 2O*opens + (2E-M)*gap length
+// the translated penalties are then divided by their common factor to keep the number of wavefronts low
+type WFPenalties struct {
+	Penalty           // translated penalties, M is always 0
+	Distance Distance // scoring model, O is 0 for every linear distance and X is unused by DistanceIndel
+	Match    int      // the caller's match penalty
+	Scale    int      // common factor divided out of the translated penalties
+	Skip     int      // translated cost of leaving a character unaligned at a free end, which is -M since the character is no longer aligned
+}
+
+// NewWFPenalties: translates penalties under distance, endsFree should be set if characters may be left unaligned
+func NewWFPenalties(penalties Penalty, distance Distance, endsFree bool) WFPenalties {
+	if distance != DistanceGapAffine2p { // only the two-piece distance has a second gap piece
+		penalties.O2 = 0
+		penalties.E2 = 0
+	}
+	switch distance {
+	case DistanceGapLinear:
+		penalties.O = 0
+	case DistanceEdit:
+		penalties = Penalty{M: 0, X: 1, O: 0, E: 1}
+	case DistanceIndel:
+		penalties = Penalty{M: 0, X: 0, O: 0, E: 1}
+	}
+
+	p := WFPenalties{
+		Penalty: Penalty{
+			M:  0,
+			X:  penalties.X,
+			O:  penalties.O,
+			E:  penalties.E,
+			O2: penalties.O2,
+			E2: penalties.E2,
+		},
+		Distance: distance,
+		Match:    penalties.M,
+		Scale:    1,
+	}
+
+	if penalties.M != 0 {
+		p.X = 2 * (penalties.X - penalties.M)
+		p.O = 2 * penalties.O
+		p.E = 2*penalties.E - penalties.M
+		if distance == DistanceGapAffine2p {
+			p.O2 = 2 * penalties.O2
+			p.E2 = 2*penalties.E2 - penalties.M
+		}
+		if endsFree {
+			p.Skip = -penalties.M
+		}
+	}
+
+	scale := 0
+	for _, v := range []int{p.X, p.O, p.E, p.O2, p.E2, p.Skip} {
+		scale = GCD(scale, v)
+	}
+	if scale > 1 {
+		p.Scale = scale
+		p.X = p.X / scale
+		p.O = p.O / scale
+		p.E = p.E / scale
+		p.O2 = p.O2 / scale
+		p.E2 = p.E2 / scale
+		p.Skip = p.Skip / scale
+	}
+
+	return p
+}
+
+// Score: translates a score under the translated penalties back to the caller's penalties, given the total length n+m of both sequences
+func (p WFPenalties) Score(score int, length int) int {
+	if p.Match == 0 {
+		return p.Scale * score
+	}
+	return (p.Match*length + p.Scale*score) / 2
+}
+
+// Open: the translated gap open of component c, which is 0 for M
+func (p WFPenalties) Open(c Component) int {
+	switch c {
+	case ComponentI, ComponentD:
+		return p.O
+	case ComponentI2, ComponentD2:
+		return p.O2
+	default:
+		return 0
+	}
+}
+
+// MaxStep: the largest score difference between a wavefront and the wavefronts it is computed from
+func (p WFPenalties) MaxStep() int {
+	step := max(p.X, p.O+p.E)
+	if p.Distance == DistanceGapAffine2p {
+		step = max(step, p.O2+p.E2)
+	}
+	return step
+}
+
+// ScoreCIGAR: the translated score of the alignment a runlength encoded CIGAR describes, where each gap takes the cheaper piece
+func (p WFPenalties) ScoreCIGAR(CIGAR string) int {
+	score := 0
+	for _, run := range Ops(CIGAR) {
+		switch run.Op {
+		case OpMismatch:
+			score += run.Length * p.X
+		case OpInsertion, OpDeletion:
+			gap := p.O + run.Length*p.E
+			if p.Distance == DistanceGapAffine2p {
+				gap = min(gap, p.O2+run.Length*p.E2)
+			}
+			score += gap
+		}
+	}
+	return score
+}
+
+// Bound: the highest translated score whose alignments of length characters score at most maxScore in the caller's penalties
+func (p WFPenalties) Bound(maxScore int, length int) int {
+	if p.Match == 0 {
+		return floorDiv(maxScore, p.Scale)
+	}
+	return floorDiv(2*maxScore-p.Match*length, p.Scale)
+}
+
+// floorDiv: a / b rounded towards negative infinity for b > 0
+func floorDiv(a int, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
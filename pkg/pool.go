@@ -0,0 +1,91 @@
+package wfa
+
+import "math/bits"
+
+// MaxPooledOffsets: the most offsets the wavefronts kept by a WavefrontPool hold together, the wavefronts released beyond it
+// are left to the garbage collector so that a long-lived pool does not keep the memory of its largest alignment
+const MaxPooledOffsets = 1 << 24
+
+// WavefrontPool: keeps the components and wavefronts of finished alignments so that later alignments reuse their memory instead of allocating it
+// a nil pool allocates everything, and a pool must not be used by alignments running concurrently
+type WavefrontPool struct {
+	wavefronts [bits.UintSize + 1][]*Wavefront // released wavefronts by the bit length of their capacity
+	components []*WavefrontComponent           // released components with their emptied slices
+	offsets    int                             // capacity of the released wavefronts, at most MaxPooledOffsets
+}
+
+// NewWavefrontPool: returns an empty pool
+func NewWavefrontPool() *WavefrontPool {
+	return &WavefrontPool{}
+}
+
+// Component: returns an empty component which keeps every wavefront, or only the last window wavefronts when window is nonzero,
+// and which takes its wavefronts from the pool
+func (pool *WavefrontPool) Component(window int) *WavefrontComponent {
+	if pool != nil {
+		ring := 0
+		if window != 0 {
+			ring = RingSize(window)
+		}
+		for i := len(pool.components) - 1; i >= 0; i-- {
+			if c := pool.components[i]; c.W.ring == ring {
+				pool.components[i] = pool.components[len(pool.components)-1]
+				pool.components = pool.components[:len(pool.components)-1]
+				return c
+			}
+		}
+	}
+
+	var c *WavefrontComponent
+	if window == 0 {
+		c = NewWavefrontComponent()
+	} else {
+		c = NewWavefrontRing(window)
+	}
+	c.pool = pool
+	return c
+}
+
+// Release: returns the components and their wavefronts to the pool, after which the components must no longer be used
+func (pool *WavefrontPool) Release(components ...*WavefrontComponent) {
+	if pool == nil {
+		return
+	}
+	for _, c := range components {
+		c.W.Reset(pool.put)
+		pool.components = append(pool.components, c)
+	}
+}
+
+// Wavefront: returns an unset wavefront for lo..hi (inclusive) from the pool, or a new one with room to widen, keeping tracebacks if asked to
+func (pool *WavefrontPool) Wavefront(lo int, hi int, tracebacks bool) *Wavefront {
+	size := hi - lo + 1
+	class := bits.Len(uint(size - 1)) // capacities of 1<<class and up fit
+	if pool != nil {
+		for c := class + 1; c < len(pool.wavefronts); c++ { // class c holds capacities of at least 1<<(c-1)
+			if l := len(pool.wavefronts[c]); l > 0 {
+				b := pool.wavefronts[c][l-1]
+				pool.wavefronts[c] = pool.wavefronts[c][:l-1]
+				pool.offsets = pool.offsets - b.Cap()
+				b.Reset(lo, hi, tracebacks)
+				return b
+			}
+		}
+	}
+	b := &Wavefront{
+		origin: lo,
+		lohi:   PackWavefrontLoHi(lo, hi),
+	}
+	b.offsets, b.tracebacks = wavefrontBuffers(size, 1<<class, tracebacks)
+	return b
+}
+
+// put: keeps b for a later Wavefront, unless the pool already holds MaxPooledOffsets offsets
+func (pool *WavefrontPool) put(b *Wavefront) {
+	if pool == nil || b == nil || b.Cap() == 0 || pool.offsets+b.Cap() > MaxPooledOffsets {
+		return
+	}
+	class := bits.Len(uint(b.Cap()))
+	pool.wavefronts[class] = append(pool.wavefronts[class], b)
+	pool.offsets = pool.offsets + b.Cap()
+}
@@ -0,0 +1,226 @@
+package sam
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	wfa "wfa/pkg"
+	"wfa/pkg/cigar"
+	"wfa/pkg/internal/tabular"
+)
+
+var (
+	ErrNoCIGAR       = cigar.ErrNoCIGAR                        // the result was aligned without doCIGAR, so it cannot be placed on the reference
+	ErrInvalidRecord = errors.New("sam: invalid record field") // a field cannot be written without breaking the line into more or fewer fields
+)
+
+// Version: the version of the SAM specification written in @HD
+const Version = "1.6"
+
+// Flag: the bitwise FLAG of a record
+type Flag uint16
+
+const (
+	FlagUnmapped      Flag = 0x4   // the query is not aligned, and the record has no position or CIGAR
+	FlagReverse       Flag = 0x10  // the query was aligned as its reverse complement, which the record holds
+	FlagSecondary     Flag = 0x100 // another record holds the primary alignment of the query
+	FlagSupplementary Flag = 0x800 // part of a chimeric alignment
+)
+
+// Reference: a reference sequence of the @SQ header lines
+type Reference struct {
+	Name   string
+	Length int
+}
+
+// Program: a program of the @PG header lines, the empty fields besides ID are left out
+type Program struct {
+	ID          string
+	Name        string
+	Version     string
+	CommandLine string
+}
+
+// Header: the header lines, SortOrder is the SO of @HD, unknown when empty
+type Header struct {
+	SortOrder  string
+	References []Reference
+	Programs   []Program
+}
+
+// Record: an alignment line, where the reference is s1 and the query s2 of the alignment
+// the empty strings and a nil CIGAR are written as *
+type Record struct {
+	QName string
+	Flag  Flag
+	RName string
+	Pos   int // leftmost reference position of the alignment, from 1, 0 when unmapped
+	MapQ  int // 255 when unavailable
+	CIGAR cigar.CIGAR
+	RNext string
+	PNext int
+	TLen  int
+	Seq   string
+	Qual  string
+	Tags  []string // optional fields such as NM:i:3, written in order
+}
+
+// NewRecord: the record of query, named qname, aligned with reference, named rname, by result
+// the CIGAR is in the extended flavor with = and X if extended is set and with M for both otherwise,
+// the ends of query the result leaves unaligned are soft clipped, and the MD:Z, NM:i and AS:i tags are computed
+// a result which is not StatusOK or aligns nothing gives an unmapped record, one without CIGAR returns an error wrapping ErrNoCIGAR,
+// and one whose coordinates or CIGAR do not fit reference and query an error wrapping cigar.ErrMismatch
+// set FlagReverse when query is the reverse complement of the read
+func NewRecord(qname string, rname string, reference string, query string, result wfa.Result, extended bool) (Record, error) {
+	record := Record{QName: qname, RName: rname, MapQ: 255, Seq: query}
+	aligned, err := cigar.FromResult(result, reference, query)
+	if err != nil {
+		return Record{}, err
+	}
+	if len(aligned) == 0 {
+		record.Flag = FlagUnmapped
+		record.RName = ""
+		record.MapQ = 0
+		return record, nil
+	}
+
+	record.Pos = result.S1Begin + 1
+	record.Tags = []string{
+		"NM:i:" + strconv.Itoa(NM(aligned)),
+		"MD:Z:" + MD(aligned, reference[result.S1Begin:result.S1End]),
+		tabular.AS(result.Score),
+	}
+	if extended {
+		aligned = aligned.Extended()
+	} else {
+		aligned = aligned.Collapse()
+	}
+	if result.S2Begin > 0 {
+		aligned = append(cigar.CIGAR{{Op: cigar.OpSoftClip, Length: result.S2Begin}}, aligned...)
+	}
+	if result.S2End < len(query) {
+		aligned = append(aligned, wfa.OpRun{Op: cigar.OpSoftClip, Length: len(query) - result.S2End})
+	}
+	record.CIGAR = aligned
+	return record, nil
+}
+
+// NM: the edit distance of the alignment, its mismatches and inserted and deleted characters
+func NM(c cigar.CIGAR) int {
+	distance := 0
+	for _, run := range c {
+		if run.Op == wfa.OpMismatch || run.Op == wfa.OpInsertion || run.Op == wfa.OpDeletion {
+			distance = distance + run.Length
+		}
+	}
+	return distance
+}
+
+// MD: the MD:Z tag of the alignment of c beginning at reference[0], the numbers of matching characters
+// between the reference characters of each mismatch and of each deletion after a ^
+// M is a match as in the CIGARs of the wfa package, an M-only CIGAR has to be expanded first
+func MD(c cigar.CIGAR, reference string) string {
+	var md strings.Builder
+	matches := 0
+	v := 0
+	for _, run := range c.Merge() {
+		switch run.Op {
+		case wfa.OpMatch, cigar.OpEqual:
+			matches = matches + run.Length
+			v = v + run.Length
+		case wfa.OpMismatch:
+			for j := 0; j < run.Length; j++ {
+				md.WriteString(strconv.Itoa(matches))
+				md.WriteByte(reference[v])
+				matches = 0
+				v++
+			}
+		case wfa.OpDeletion:
+			md.WriteString(strconv.Itoa(matches))
+			md.WriteByte('^')
+			md.WriteString(reference[v : v+run.Length])
+			matches = 0
+			v = v + run.Length
+		}
+	}
+	md.WriteString(strconv.Itoa(matches))
+	return md.String()
+}
+
+// Writer: writes a header and records in SAM format, buffering them until Flush
+type Writer struct {
+	w *tabular.Writer
+}
+
+// NewWriter: returns a Writer writing to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: tabular.NewWriter(w)}
+}
+
+// WriteHeader: writes the @HD line, an @SQ line for each reference and a @PG line for each program
+func (w *Writer) WriteHeader(header Header) error {
+	sortOrder := header.SortOrder
+	if sortOrder == "" {
+		sortOrder = "unknown"
+	}
+	fields := [][]string{{"@HD", "VN:" + Version, "SO:" + sortOrder}}
+	for _, reference := range header.References {
+		fields = append(fields, []string{"@SQ", "SN:" + reference.Name, "LN:" + strconv.Itoa(reference.Length)})
+	}
+	for _, program := range header.Programs {
+		line := []string{"@PG", "ID:" + program.ID}
+		for _, field := range [][2]string{{"PN", program.Name}, {"VN", program.Version}, {"CL", program.CommandLine}} {
+			if field[1] != "" {
+				line = append(line, field[0]+":"+field[1])
+			}
+		}
+		fields = append(fields, line)
+	}
+	for _, line := range fields {
+		if err := w.w.WriteLine(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write: writes record as a line of tab separated fields, returning an error wrapping ErrInvalidRecord
+// if a name holds whitespace or Qual is not as long as Seq
+func (w *Writer) Write(record Record) error {
+	if record.QName == "" || strings.ContainsAny(record.QName, " \t\n\r") || strings.ContainsAny(record.RName, " \t\n\r") || strings.ContainsAny(record.RNext, " \t\n\r") {
+		return fmt.Errorf("%w: names %q, %q, %q must be nonempty and without whitespace", ErrInvalidRecord, record.QName, record.RName, record.RNext)
+	}
+	if record.Qual != "" && len(record.Qual) != len(record.Seq) {
+		return fmt.Errorf("%w: %d qualities for %d characters", ErrInvalidRecord, len(record.Qual), len(record.Seq))
+	}
+	CIGAR := record.CIGAR.String()
+	line := []string{
+		record.QName,
+		strconv.Itoa(int(record.Flag)),
+		orStar(record.RName),
+		strconv.Itoa(record.Pos),
+		strconv.Itoa(record.MapQ),
+		orStar(CIGAR),
+		orStar(record.RNext),
+		strconv.Itoa(record.PNext),
+		strconv.Itoa(record.TLen),
+		orStar(record.Seq),
+		orStar(record.Qual),
+	}
+	return w.w.WriteLine(append(line, record.Tags...))
+}
+
+// Flush: writes the buffered lines to the underlying writer
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// orStar: s, or * for a missing field
+func orStar(s string) string {
+	if s == "" {
+		return "*"
+	}
+	return s
+}
@@ -0,0 +1,288 @@
+package seqio
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	wfa "wfa/pkg"
+)
+
+var ErrFormat = errors.New("seqio: malformed input") // the input is not FASTA, FASTQ or pairs, or a record is cut short
+
+// Record: a sequence with its name, the first word of its header line, the rest of that line and the qualities of a FASTQ record
+type Record struct {
+	Name        string
+	Description string
+	Seq         string
+	Qual        string // empty for FASTA
+}
+
+// Format: the format a Writer writes
+type Format byte
+
+const (
+	FormatFASTA Format = iota
+	FormatFASTQ
+)
+
+// lineReader: reads lines without their line endings, counting them for the errors and letting the last one be read again
+type lineReader struct {
+	r       *bufio.Reader
+	number  int
+	pending *string
+}
+
+// newLineReader: reads from r, decompressing it if it starts like gzip
+func newLineReader(r io.Reader) (*lineReader, error) {
+	buffered := bufio.NewReaderSize(r, 1<<16)
+	if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		decompressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		buffered = bufio.NewReaderSize(decompressed, 1<<16)
+	}
+	return &lineReader{r: buffered}, nil
+}
+
+// line: the next line, io.EOF once there are none
+func (l *lineReader) line() (string, error) {
+	if l.pending != nil {
+		line := *l.pending
+		l.pending = nil
+		l.number++
+		return line, nil
+	}
+	line, err := l.r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	l.number++
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// unread: gives back line, which the next call to line returns
+func (l *lineReader) unread(line string) {
+	l.pending = &line
+	l.number--
+}
+
+// errorf: an error wrapping ErrFormat at the current line
+func (l *lineReader) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: line %d: %s", ErrFormat, l.number, fmt.Sprintf(format, args...))
+}
+
+// Reader: streams the records of FASTA or FASTQ input, which may be gzip compressed, with sequences and qualities over several lines
+type Reader struct {
+	lines *lineReader
+}
+
+// NewReader: returns a Reader of r, which is decompressed if it starts like gzip
+func NewReader(r io.Reader) (*Reader, error) {
+	lines, err := newLineReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{lines: lines}, nil
+}
+
+// Read: the next record, whose header starts with > for FASTA and @ for FASTQ, io.EOF once there are none
+// returns an error wrapping ErrFormat for a line outside of a record or qualities not as long as the sequence
+func (r *Reader) Read() (Record, error) {
+	header, err := r.lines.line()
+	for err == nil && strings.TrimSpace(header) == "" { // blank lines between records
+		header, err = r.lines.line()
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	record := Record{Name: header[1:]}
+	if i := strings.IndexAny(record.Name, " \t"); i >= 0 {
+		record.Name, record.Description = record.Name[:i], record.Name[i+1:]
+	}
+	switch header[0] {
+	case '>':
+		record.Seq, err = r.sequence(">")
+		return record, err
+	case '@':
+		if record.Seq, err = r.sequence("+"); err != nil {
+			return Record{}, err
+		}
+		if separator, err := r.lines.line(); err != nil || !strings.HasPrefix(separator, "+") {
+			return Record{}, r.lines.errorf("record %s has no + line", record.Name)
+		}
+		record.Qual, err = r.quality(len(record.Seq))
+		if err != nil {
+			return Record{}, err
+		}
+		return record, nil
+	default:
+		return Record{}, r.lines.errorf("%q does not start a record with > or @", header)
+	}
+}
+
+// sequence: the lines up to the next one starting with end, which is left to be read
+func (r *Reader) sequence(end string) (string, error) {
+	var seq strings.Builder
+	for {
+		line, err := r.lines.line()
+		if err == io.EOF {
+			return seq.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(line, end) {
+			r.lines.unread(line)
+			return seq.String(), nil
+		}
+		seq.WriteString(strings.TrimSpace(line))
+	}
+}
+
+// quality: lines until n qualities are read, since a line of qualities may start with @ as a header does
+func (r *Reader) quality(n int) (string, error) {
+	var qual strings.Builder
+	for qual.Len() < n {
+		line, err := r.lines.line()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		qual.WriteString(strings.TrimSpace(line))
+	}
+	if qual.Len() != n {
+		return "", r.lines.errorf("%d qualities for %d characters", qual.Len(), n)
+	}
+	return qual.String(), nil
+}
+
+// ReadAll: every remaining record
+func (r *Reader) ReadAll() ([]Record, error) {
+	records := []Record{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+// PairReader: streams the pairs of the format of the WFA2-lib tools, which may be gzip compressed,
+// where each pair is a line of s1 after a > followed by a line of s2 after a <
+type PairReader struct {
+	lines *lineReader
+	id    int
+}
+
+// NewPairReader: returns a PairReader of r, which is decompressed if it starts like gzip
+func NewPairReader(r io.Reader) (*PairReader, error) {
+	lines, err := newLineReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &PairReader{lines: lines}, nil
+}
+
+// Read: the next pair with the ID of its position from 0, ready for wfa.AlignBatch or wfa.AlignStream, io.EOF once there are none
+// returns an error wrapping ErrFormat for a line which does not start with the > or < expected
+func (r *PairReader) Read() (wfa.Pair, error) {
+	s1, err := r.lines.line()
+	if err != nil {
+		return wfa.Pair{}, err
+	}
+	if !strings.HasPrefix(s1, ">") {
+		return wfa.Pair{}, r.lines.errorf("%q does not start a pair with >", s1)
+	}
+	s2, err := r.lines.line()
+	if err == io.EOF || (err == nil && !strings.HasPrefix(s2, "<")) {
+		return wfa.Pair{}, r.lines.errorf("pair %d has no line starting with <", r.id)
+	}
+	if err != nil {
+		return wfa.Pair{}, err
+	}
+	pair := wfa.Pair{ID: r.id, S1: s1[1:], S2: s2[1:]}
+	r.id++
+	return pair, nil
+}
+
+// ReadAll: every remaining pair
+func (r *PairReader) ReadAll() ([]wfa.Pair, error) {
+	pairs := []wfa.Pair{}
+	for {
+		pair, err := r.Read()
+		if err == io.EOF {
+			return pairs, nil
+		}
+		if err != nil {
+			return pairs, err
+		}
+		pairs = append(pairs, pair)
+	}
+}
+
+// Writer: writes records as FASTA or FASTQ, buffering them until Flush, pass a gzip.Writer to compress them
+type Writer struct {
+	w      *bufio.Writer
+	format Format
+	width  int
+}
+
+// NewWriter: returns a Writer of format to w, which wraps sequences and qualities into lines of width characters, or not at all if width <= 0
+func NewWriter(w io.Writer, format Format, width int) *Writer {
+	return &Writer{w: bufio.NewWriter(w), format: format, width: width}
+}
+
+// Write: writes record, returning an error wrapping ErrFormat if its name is empty or holds whitespace,
+// or if it is written as FASTQ with qualities not as long as its sequence
+func (w *Writer) Write(record Record) error {
+	if record.Name == "" || strings.ContainsAny(record.Name, " \t\n\r") || strings.ContainsAny(record.Description, "\n\r") {
+		return fmt.Errorf("%w: name %q must be nonempty and without whitespace, and the description on one line", ErrFormat, record.Name)
+	}
+	header := record.Name
+	if record.Description != "" {
+		header = header + " " + record.Description
+	}
+	if w.format == FormatFASTA {
+		w.w.WriteString(">" + header + "\n")
+		return w.wrapped(record.Seq)
+	}
+	if len(record.Qual) != len(record.Seq) {
+		return fmt.Errorf("%w: record %s has %d qualities for %d characters", ErrFormat, record.Name, len(record.Qual), len(record.Seq))
+	}
+	w.w.WriteString("@" + header + "\n")
+	w.wrapped(record.Seq)
+	w.w.WriteString("+\n")
+	return w.wrapped(record.Qual)
+}
+
+// wrapped: writes s in lines of w.width characters
+func (w *Writer) wrapped(s string) error {
+	if w.width <= 0 {
+		_, err := w.w.WriteString(s + "\n")
+		return err
+	}
+	for i := 0; i < len(s); i = i + w.width {
+		if _, err := w.w.WriteString(s[i:min(i+w.width, len(s))] + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush: writes the buffered records to the underlying writer
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
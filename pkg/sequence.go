@@ -0,0 +1,117 @@
+package wfa
+
+// Sequences: the pair s1, s2 being aligned, which the wavefronts only read through their lengths and the matches along a diagonal,
+// so that strings and other kinds of sequences share the same engine
+type Sequences interface {
+	// Lens: the lengths n of s1 and m of s2
+	Lens() (int, int)
+	// Matches: the number of leading characters s1[v:] and s2[h:] have in common, 0 past the end of either
+	Matches(v int, h int) int
+	// Slice: the pair s1[v_begin:v_end], s2[h_begin:h_end]
+	Slice(v_begin int, v_end int, h_begin int, h_end int) Sequences
+	// Reverse: the pair with both sequences reversed, which the reverse wavefronts align
+	Reverse() Sequences
+}
+
+// stringPair: Sequences of two strings compared byte by byte
+type stringPair struct {
+	s1 string
+	s2 string
+}
+
+// StringSequences: the Sequences to align s1 with s2
+func StringSequences(s1 string, s2 string) Sequences {
+	return stringPair{s1: s1, s2: s2}
+}
+
+func (p stringPair) Lens() (int, int) {
+	return len(p.s1), len(p.s2)
+}
+
+func (p stringPair) Matches(v int, h int) int {
+	if v < len(p.s1) && h < len(p.s2) && p.s1[v] == p.s2[h] { // most diagonals stop at once, without the words compared by MatchLength
+		return MatchLength(p.s1[v:], p.s2[h:])
+	}
+	return 0
+}
+
+func (p stringPair) Slice(v_begin int, v_end int, h_begin int, h_end int) Sequences {
+	return stringPair{s1: p.s1[v_begin:v_end], s2: p.s2[h_begin:h_end]}
+}
+
+func (p stringPair) Reverse() Sequences {
+	return stringPair{s1: ReverseString(p.s1), s2: ReverseString(p.s2)}
+}
+
+// tokenPair: Sequences of two slices compared element by element with ==, such as words, lines, residues or runes
+type tokenPair[T comparable] struct {
+	s1 []T
+	s2 []T
+}
+
+// TokenSequences: the Sequences to align the tokens s1 with s2
+func TokenSequences[T comparable](s1 []T, s2 []T) Sequences {
+	return tokenPair[T]{s1: s1, s2: s2}
+}
+
+func (p tokenPair[T]) Lens() (int, int) {
+	return len(p.s1), len(p.s2)
+}
+
+func (p tokenPair[T]) Matches(v int, h int) int {
+	matches := 0
+	for v+matches < len(p.s1) && h+matches < len(p.s2) && p.s1[v+matches] == p.s2[h+matches] {
+		matches++
+	}
+	return matches
+}
+
+func (p tokenPair[T]) Slice(v_begin int, v_end int, h_begin int, h_end int) Sequences {
+	return tokenPair[T]{s1: p.s1[v_begin:v_end], s2: p.s2[h_begin:h_end]}
+}
+
+func (p tokenPair[T]) Reverse() Sequences {
+	return tokenPair[T]{s1: reverseSlice(p.s1), s2: reverseSlice(p.s2)}
+}
+
+// funcPair: Sequences of two slices compared element by element with equal
+type funcPair[T any] struct {
+	s1    []T
+	s2    []T
+	equal func(T, T) bool
+}
+
+// FuncSequences: the Sequences to align s1 with s2 where two elements match when equal(s1[v], s2[h])
+// equal only has to be symmetric, for example to compare words ignoring case or residues by class
+func FuncSequences[T any](s1 []T, s2 []T, equal func(T, T) bool) Sequences {
+	return funcPair[T]{s1: s1, s2: s2, equal: equal}
+}
+
+func (p funcPair[T]) Lens() (int, int) {
+	return len(p.s1), len(p.s2)
+}
+
+func (p funcPair[T]) Matches(v int, h int) int {
+	matches := 0
+	for v+matches < len(p.s1) && h+matches < len(p.s2) && p.equal(p.s1[v+matches], p.s2[h+matches]) {
+		matches++
+	}
+	return matches
+}
+
+func (p funcPair[T]) Slice(v_begin int, v_end int, h_begin int, h_end int) Sequences {
+	return funcPair[T]{s1: p.s1[v_begin:v_end], s2: p.s2[h_begin:h_end], equal: p.equal}
+}
+
+func (p funcPair[T]) Reverse() Sequences {
+	return funcPair[T]{s1: reverseSlice(p.s1), s2: reverseSlice(p.s2), equal: p.equal}
+}
+
+// reverseSlice: a reversed copy of s, like ReverseString
+func reverseSlice[T any](s []T) []T {
+	reversed := make([]T, len(s))
+	for i := range s {
+		reversed[len(s)-1-i] = s[i]
+	}
+	return reversed
+}
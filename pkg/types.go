@@ -1,21 +1,159 @@
 package wfa
 
+import (
+	"math"
+	"strconv"
+)
+
 type Integer interface {
 	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
 }
 
 type Result struct {
-	Score int
-	CIGAR string
+	Status  Status // unless it is StatusOK, the other fields are unset
+	Score   int
+	CIGAR   string
+	S1Begin int // the CIGAR aligns s1[S1Begin:S1End] to s2[S2Begin:S2End], begins are -1 when free and doCIGAR is false
+	S1End   int
+	S2Begin int
+	S2End   int
+
+	Suboptimal bool // a heuristic dropped part of the wavefronts, so a better alignment may exist
 }
 
+// Status: whether an alignment was found
+type Status byte
+
+const (
+	StatusOK               Status = iota
+	StatusMaxScoreExceeded        // every alignment scores more than Options.MaxScore
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusMaxScoreExceeded:
+		return "max-score-exceeded"
+	default:
+		return "unknown"
+	}
+}
+
+// CanceledError: the error of an alignment given up because its context was done, with the progress it made
+type CanceledError struct {
+	Err   error // the error of the context
+	Score int   // score of the last wavefront computed, in the penalties translated to M = 0
+	Width int   // number of diagonals of that wavefront
+}
+
+func (e *CanceledError) Error() string {
+	return "wfa: alignment canceled at score " + strconv.Itoa(e.Score) + " with wavefront width " + strconv.Itoa(e.Width) + ": " + e.Err.Error()
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// Penalty: gap-affine penalties where a gap of length l costs O + l*E
+// M may be nonzero (negative for a match bonus) as long as M < X and M < 2E, ends-free alignments also need M <= 0
+// O2, E2 are the second piece of DistanceGapAffine2p, where a gap of length l costs min(O + l*E, O2 + l*E2), and need M < 2E2
+// Validate checks these along with O, O2 >= 0
 type Penalty struct {
-	M int
-	X int
-	O int
-	E int
+	M  int
+	X  int
+	O  int
+	E  int
+	O2 int
+	E2 int
 }
 
+// MemoryMode: selects how many wavefronts are kept in memory during alignment
+type MemoryMode byte
+
+const (
+	MemoryHigh     MemoryMode = iota // keep every wavefront and backtrace directly, O(s^2) memory
+	MemoryUltralow                   // bidirectional WFA, recursing on breakpoints with O(s) memory, suited to whole chromosomes
+)
+
+// Span: selects which parts of s1 and s2 have to be aligned
+// SpanLocal seeds every cell of an anti-diagonal as a possible begin every few scores, so rather than with the score as for the other spans,
+// its time grows as O(n·m) for dissimilar sequences
+type Span byte
+
+const (
+	SpanGlobal   Span = iota // end-to-end alignment of s1 and s2
+	SpanEndsFree             // semi-global alignment, leading and trailing characters within EndsFree are skipped at no cost
+	SpanLocal                // local alignment of the best scoring substrings, needs a match bonus M < 0 and ignores EndsFree, heuristics and MaxScore
+)
+
+// EndsFree: how many leading and trailing characters of s1 (pattern) and s2 (text) may be left unaligned
+type EndsFree struct {
+	S1Begin int
+	S1End   int
+	S2Begin int
+	S2End   int
+}
+
+// Distance: selects the scoring model and with it the wavefront components which are computed
+type Distance byte
+
+const (
+	DistanceGapAffine   Distance = iota // M, X, O, E with M/I/D components, a gap of length l costs O + l*E
+	DistanceGapAffine2p                 // M, X, O, E, O2, E2 with M/I/D/I2/D2 components, a gap of length l costs min(O + l*E, O2 + l*E2)
+	DistanceGapLinear                   // M, X, E with a single component, a gap of length l costs l*E and O is ignored
+	DistanceEdit                        // Levenshtein distance with a single component, penalties are ignored
+	DistanceIndel                       // insertions and deletions only with a single component, penalties are ignored
+)
+
+// Linear: whether the distance is computed on the M component alone
+func (d Distance) Linear() bool {
+	return d == DistanceGapLinear || d == DistanceEdit || d == DistanceIndel
+}
+
+// Reduction: adaptive wavefront reduction, every Steps scores a wavefront spanning at least MinWavefrontLength diagonals
+// drops the outer diagonals which are more than MaxDistance further from the end than the closest diagonal
+type Reduction struct {
+	MinWavefrontLength int
+	MaxDistance        int
+	Steps              int
+}
+
+// Heuristic: optional heuristics giving up the guarantee of an optimal alignment for time and memory, the zero value disables them
+// a nonzero XDrop or ZDrop turns the alignment into an extension from the start of s1, s2 which returns the best scoring prefix alignment
+type Heuristic struct {
+	Reduction *Reduction
+	XDrop     int // drop diagonals scoring more than XDrop above the best score seen, stopping once none are left
+	ZDrop     int // stop once the best of a wavefront scores more than ZDrop + E*(diagonal distance) above the best score seen
+}
+
+// Extension: whether the heuristics make the alignment an extension
+func (h Heuristic) Extension() bool {
+	return h.XDrop > 0 || h.ZDrop > 0
+}
+
+// Options: optional alignment settings, the zero value matches WFAlign
+type Options struct {
+	Memory    MemoryMode
+	Span      Span
+	EndsFree  EndsFree // used when Span is SpanEndsFree
+	Distance  Distance
+	Heuristic Heuristic
+	Bounded   bool // give up with StatusMaxScoreExceeded as soon as the score exceeds MaxScore, ignored by extensions
+	MaxScore  int
+}
+
+// Component: identifies one of the M/I/D/I2/D2 wavefront components
+type Component byte
+
+const (
+	ComponentM Component = iota
+	ComponentI
+	ComponentD
+	ComponentI2 // second piece insertions of DistanceGapAffine2p
+	ComponentD2 // second piece deletions of DistanceGapAffine2p
+)
+
 type Traceback byte
 
 const (
@@ -27,90 +165,171 @@ const (
 	Ins
 	Del
 	End
+	OpenIns2 // the second piece tracebacks of DistanceGapAffine2p
+	ExtdIns2
+	OpenDel2
+	ExtdDel2
+	Ins2
+	Del2
 )
 
-// bitpacked wavefront lo/hi values with 32 bits each
-type WavefrontLoHi uint64
+// wavefront lo/hi values, kept as full ints since diagonals of sequences longer than 2^31 do not fit in 32 bits
+type WavefrontLoHi struct {
+	lo int
+	hi int
+}
 
 func PackWavefrontLoHi(lo int, hi int) WavefrontLoHi {
-	loBM := int64(int32(lo)) & 0x0000_0000_FFFF_FFFF
-	hiBM := int64(int64(hi) << 32)
-	return WavefrontLoHi(hiBM | loBM)
+	return WavefrontLoHi{lo: lo, hi: hi}
 }
 
 func UnpackWavefrontLoHi(lohi WavefrontLoHi) (int, int) {
-	loBM := int(int32(lohi & 0x0000_0000_FFFF_FFFF))
-	hiBM := int(int32(lohi & 0xFFFF_FFFF_0000_0000 >> 32))
-	return loBM, hiBM
-}
-
-// bitpacked wavefront values with 1 valid bit, 3 traceback bits, and 60 bits for the diag distance
-type WavefrontValue uint64
-
-// PackWavefrontValue: packs a diag value and traceback into a WavefrontValue
-func PackWavefrontValue(value uint64, traceback Traceback) WavefrontValue {
-	validBM := uint64(0x8000_0000_0000_0000)
-	tracebackBM := uint64(traceback&0x0000_0007) << 60
-	valueBM := uint64(value) & 0x0FFF_FFFF_FFFF_FFFF
-	return WavefrontValue(validBM | tracebackBM | valueBM)
-}
-
-// UnpackWavefrontValue: opens a WavefrontValue into a valid bool, diag value and traceback
-func UnpackWavefrontValue(wfv WavefrontValue) (bool, uint64, Traceback) {
-	validBM := wfv&0x8000_0000_0000_0000 != 0
-	tracebackBM := uint8(wfv & 0x7000_0000_0000_0000 >> 60)
-	valueBM := uint64(wfv & 0x0000_0000_FFFF_FFFF)
-	return validBM, valueBM, Traceback(tracebackBM)
+	return lohi.lo, lohi.hi
 }
 
-// Wavefront: stores a single wavefront, stores wavefront's lo value and hi is naturally lo + len(data)
-type Wavefront struct { // since wavefronts store diag distance, they should never be negative, and traceback data can be stored as uint8
-	data []WavefrontValue
-	lohi WavefrontLoHi
+// Wavefront: stores a single wavefront as separate arrays, the offsets of diagonals lo..hi stored plus one so that 0 marks an unset diagonal,
+// and the tracebacks packed eight to a word from diagonal origin, which stays put when a trim moves lo since diagonals share words
+type Wavefront struct {
+	offsets    []uint32 // offset+1 of each diagonal while every offset fits in 32 bits
+	wide       []uint64 // offset+1 of each diagonal once one did not fit in offsets, which is then nil
+	tracebacks []uint32 // 4-bit traceback of each diagonal from origin, nil when the wavefront is never backtraced
+	origin     int
+	lohi       WavefrontLoHi
 }
 
 // NewWavefront: returns a new wavefront with size accomodating lo and hi (inclusive)
 func NewWavefront(lo int, hi int) *Wavefront {
 	a := &Wavefront{}
 	a.lohi = PackWavefrontLoHi(lo, hi)
-	size := hi - lo
-	a.data = make([]WavefrontValue, size+1)
+	a.origin = lo
+	size := hi - lo + 1
+	a.offsets, a.tracebacks = wavefrontBuffers(size, size, true)
 
 	return a
 }
 
-// TranslateIndex: utility function for getting the data index given a diagonal
+// wavefrontBuffers: the offsets of size diagonals with room for capacity, and their tracebacks if kept,
+// cut from a single allocation since a backtraced alignment allocates a wavefront per component and score
+func wavefrontBuffers(size int, capacity int, tracebacks bool) ([]uint32, []uint32) {
+	if !tracebacks {
+		return make([]uint32, size, capacity), nil
+	}
+	buffer := make([]uint32, capacity+(capacity+7)/8)
+	return buffer[:size:capacity], buffer[capacity : capacity+(size+7)/8]
+}
+
+// TranslateIndex: utility function for getting the offsets index given a diagonal
 func (a *Wavefront) TranslateIndex(diagonal int) int {
-	lo := int(int32(a.lohi & 0x0000_0000_FFFF_FFFF))
-	return diagonal - lo
+	return diagonal - a.lohi.lo
 }
 
-// Get: returns WavefrontValue for given diagonal
-func (a *Wavefront) Get(diagonal int) WavefrontValue {
-	actualIdx := a.TranslateIndex(diagonal)
-	if 0 <= actualIdx && actualIdx < len(a.data) { // idx is in the slice
-		return a.data[actualIdx]
-	} else { // idx is out of the slice
-		return 0
+// Offset: returns whether the diagonal is set and its offset
+func (a *Wavefront) Offset(diagonal int) (bool, uint64) {
+	actualIdx := uint(a.TranslateIndex(diagonal))
+	if actualIdx < uint(len(a.offsets)) {
+		offset := a.offsets[actualIdx]
+		return offset != 0, uint64(max(offset, 1) - 1)
 	}
+	return a.wideOffset(actualIdx) // offsets is empty once widened, otherwise idx is out of the slice
 }
 
-// Set: the diagonal to a WavefrontValue
-func (a *Wavefront) Set(diagonal int, value WavefrontValue) {
+func (a *Wavefront) wideOffset(actualIdx uint) (bool, uint64) {
+	if actualIdx >= uint(len(a.wide)) {
+		return false, 0
+	}
+	offset := a.wide[actualIdx]
+	return offset != 0, max(offset, 1) - 1
+}
+
+// Get: returns whether the diagonal is set, its offset and traceback, which is End if the wavefront keeps no tracebacks
+func (a *Wavefront) Get(diagonal int) (bool, uint64, Traceback) {
+	ok, offset := a.Offset(diagonal)
+	if !ok || a.tracebacks == nil {
+		return ok, offset, End
+	}
+	i := diagonal - a.origin
+	return true, offset, Traceback(a.tracebacks[i>>3] >> (i & 7 * 4) & 0xF)
+}
+
+// Cap: the number of diagonals the wavefront can hold without allocating
+func (a *Wavefront) Cap() int {
+	if a.wide != nil {
+		return cap(a.wide)
+	}
+	return cap(a.offsets)
+}
+
+// Reset: reuses the buffers of a for an unset wavefront spanning lo..hi (inclusive), which has to fit in its capacity,
+// allocating tracebacks if they are kept and a had none or too few
+func (a *Wavefront) Reset(lo int, hi int, tracebacks bool) {
+	size := hi - lo + 1
+	if a.wide != nil {
+		a.wide = a.wide[:size]
+		clear(a.wide)
+	} else {
+		a.offsets = a.offsets[:size]
+		clear(a.offsets)
+	}
+	if !tracebacks {
+		a.tracebacks = nil
+	} else if cap(a.tracebacks) >= (size+7)/8 {
+		a.tracebacks = a.tracebacks[:(size+7)/8]
+		clear(a.tracebacks)
+	} else {
+		a.tracebacks = make([]uint32, (size+7)/8, (a.Cap()+7)/8)
+	}
+	a.origin = lo
+	a.lohi = PackWavefrontLoHi(lo, hi)
+}
+
+// SetOffset: the offset of the diagonal, which has to be within the wavefront, keeping its traceback
+func (a *Wavefront) SetOffset(diagonal int, offset uint64) {
 	actualIdx := a.TranslateIndex(diagonal)
 
-	/* in theory idx is always in bounds because the wavefront is preallocated
-	if actualIdx < 0 || actualIdx >= len(a.data) {
+	if a.wide == nil && offset < math.MaxUint32 {
+		a.offsets[actualIdx] = uint32(offset + 1)
 		return
 	}
-	*/
+	if a.wide == nil { // only sequences longer than 2^32 reach such offsets
+		a.widen()
+	}
+	a.wide[actualIdx] = offset + 1
+}
+
+// Set: the offset and traceback of the diagonal, which has to be within the wavefront
+func (a *Wavefront) Set(diagonal int, offset uint64, traceback Traceback) {
+	a.SetOffset(diagonal, offset)
+	if a.tracebacks != nil {
+		i := diagonal - a.origin
+		shift := i & 7 * 4
+		a.tracebacks[i>>3] = a.tracebacks[i>>3]&^(0xF<<shift) | uint32(traceback)<<shift
+	}
+}
 
-	a.data[actualIdx] = value
+// widen: moves the offsets to 64 bits, keeping the capacity
+func (a *Wavefront) widen() {
+	a.wide = make([]uint64, len(a.offsets), cap(a.offsets))
+	for i, offset := range a.offsets {
+		a.wide[i] = uint64(offset)
+	}
+	a.offsets = nil
+}
+
+// trim: shrinks the wavefront to the diagonals lo..hi, which have to be within it
+func (a *Wavefront) trim(lo int, hi int) {
+	if a.wide != nil {
+		a.wide = a.wide[lo-a.lohi.lo : hi-a.lohi.lo+1]
+	} else {
+		a.offsets = a.offsets[lo-a.lohi.lo : hi-a.lohi.lo+1]
+	}
+	a.lohi = PackWavefrontLoHi(lo, hi)
 }
 
 // WavefrontComponent: each M/I/D wavefront matrix including the wavefront data, lo and hi
 type WavefrontComponent struct {
-	W *PositiveSlice[*Wavefront] // wavefront diag distance and traceback for each wavefront
+	W          *PositiveSlice[*Wavefront] // wavefront diag distance and traceback for each wavefront
+	pool       *WavefrontPool             // where new wavefronts are taken from, nil to allocate them
+	tracebacks bool                       // whether the wavefronts keep tracebacks for a backtrace
 }
 
 // NewWavefrontComponent: returns initialized WavefrontComponent
@@ -123,22 +342,34 @@ func NewWavefrontComponent() *WavefrontComponent {
 	w := &WavefrontComponent{
 		W: &PositiveSlice[*Wavefront]{
 			defaultValue: &Wavefront{
-				data: []WavefrontValue{0},
+				offsets: []uint32{0},
 			},
 		},
+		tracebacks: true,
 	}
 
 	return w
 }
 
+// NewWavefrontRing: returns a WavefrontComponent keeping only the last window wavefronts, where each new wavefront reuses the buffer of the one it replaces
+// window must exceed the largest score step read by wfNext, and wavefronts older than window scores read as unset
+// since a ring cannot be backtraced its wavefronts keep no tracebacks, and read End instead
+func NewWavefrontRing(window int) *WavefrontComponent {
+	return &WavefrontComponent{
+		W: NewRingSlice(window, &Wavefront{
+			offsets: []uint32{0},
+		}),
+	}
+}
+
 // GetVal: get value for wavefront=score, diag=k => returns ok, value, traceback
 func (w *WavefrontComponent) GetVal(score int, k int) (bool, uint64, Traceback) {
-	return UnpackWavefrontValue(w.W.Get(score).Get(k))
+	return w.W.Get(score).Get(k)
 }
 
 // SetVal: set value, traceback for wavefront=score, diag=k
 func (w *WavefrontComponent) SetVal(score int, k int, val uint64, tb Traceback) {
-	w.W.Get(score).Set(k, PackWavefrontValue(val, tb))
+	w.W.Get(score).Set(k, val, tb)
 }
 
 // GetLoHi: get lo and hi for wavefront=score
@@ -147,8 +378,68 @@ func (w *WavefrontComponent) GetLoHi(score int) (bool, int, int) {
 	return w.W.Valid(score), lo, hi
 }
 
-// SetLoHi: set lo and hi for wavefront=score
+// GetOffset: get value for wavefront=score, diag=k without its traceback => returns ok, value
+func (w *WavefrontComponent) GetOffset(score int, k int) (bool, uint64) {
+	return w.W.Get(score).Offset(k)
+}
+
+// SetLoHi: set lo and hi for wavefront=score, a ring reuses the buffer of the wavefront replaced when it is large enough
 func (w *WavefrontComponent) SetLoHi(score int, lo int, hi int) {
-	b := NewWavefront(lo, hi)
+	b, ok := w.W.Recycle(score)
+	if ok && b.Cap() > hi-lo {
+		b.Reset(lo, hi, w.tracebacks)
+	} else {
+		if ok {
+			w.pool.put(b)
+		}
+		b = w.newWavefront(lo, hi)
+	}
 	w.W.Set(score, b)
 }
+
+// newWavefront: returns an unset wavefront for lo..hi, from the pool or with room to widen if the component reuses its wavefronts
+func (w *WavefrontComponent) newWavefront(lo int, hi int) *Wavefront {
+	if w.pool == nil && w.W.ring == 0 {
+		return NewWavefront(lo, hi)
+	}
+	return w.pool.Wavefront(lo, hi, w.tracebacks)
+}
+
+// TrimLoHi: shrinks wavefront=score to the diagonals within lo..hi, removing it if none are left
+func (w *WavefrontComponent) TrimLoHi(score int, lo int, hi int) {
+	if !w.W.Valid(score) {
+		return
+	}
+	b := w.W.Get(score)
+	old_lo, old_hi := UnpackWavefrontLoHi(b.lohi)
+	lo = max(lo, old_lo)
+	hi = min(hi, old_hi)
+	if lo > hi {
+		w.W.Unset(score)
+		return
+	}
+	b.trim(lo, hi)
+}
+
+// SetSource: sets val at wavefront=score, diag=k as a starting point of the alignment unless it is already further, growing the wavefront to include k
+func (w *WavefrontComponent) SetSource(score int, k int, val uint64) {
+	valid, lo, hi := w.GetLoHi(score)
+	if !valid {
+		w.SetLoHi(score, k, k)
+	} else if k < lo || k > hi {
+		old := w.W.Get(score)
+		b := w.newWavefront(min(lo, k), max(hi, k))
+		for d := lo; d <= hi; d++ {
+			if ok, val, tb := old.Get(d); ok {
+				b.Set(d, val, tb)
+			}
+		}
+		w.W.Set(score, b)
+		w.pool.put(old)
+	}
+
+	ok, current := w.GetOffset(score, k)
+	if !ok || val > current {
+		w.SetVal(score, k, val, End)
+	}
+}
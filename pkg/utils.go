@@ -1,5 +1,10 @@
 package wfa
 
+import (
+	"math/bits"
+	"strings"
+)
+
 const MaxInt = int(^uint(0) >> 1)
 const MinInt = -MaxInt - 1
 
@@ -47,6 +52,127 @@ func RunLengthDecode(encoded string) string {
 	return string(decoded)
 }
 
+// encode a string of operations such as a decoded CIGAR into its runlength form
+func RunLengthEncode(decoded string) string {
+	var encoded strings.Builder
+	i := 0
+
+	for i < len(decoded) {
+		j := i
+		for j < len(decoded) && decoded[j] == decoded[i] {
+			j++
+		}
+		encoded.WriteString(UIntToString(uint(j - i)))
+		encoded.WriteByte(decoded[i])
+		i = j
+	}
+
+	return encoded.String()
+}
+
+// join two runlength encoded CIGARs, merging the runs at the boundary if they share an op
+func JoinCIGAR(left string, right string) string {
+	if left == "" || right == "" {
+		return left + right
+	}
+
+	leftOp := left[len(left)-1]
+	l := len(left) - 1
+	for l > 0 && left[l-1] >= '0' && left[l-1] <= '9' {
+		l--
+	}
+	r := 0
+	for r < len(right) && right[r] >= '0' && right[r] <= '9' {
+		r++
+	}
+	if r == len(right) || right[r] != leftOp {
+		return left + right
+	}
+
+	leftCount := 0
+	for _, c := range left[l : len(left)-1] {
+		leftCount = leftCount*10 + int(c-'0')
+	}
+	rightCount := 0
+	for _, c := range right[:r] {
+		rightCount = rightCount*10 + int(c-'0')
+	}
+
+	return left[:l] + UIntToString(uint(leftCount+rightCount)) + right[r:]
+}
+
+// count how many characters of s1 and s2 a runlength encoded CIGAR consumes
+func CIGARLengths(CIGAR string) (int, int) {
+	s1Len := 0
+	s2Len := 0
+	for _, run := range Ops(CIGAR) {
+		switch run.Op {
+		case OpMatch, OpMismatch:
+			s1Len += run.Length
+			s2Len += run.Length
+		case OpDeletion:
+			s1Len += run.Length
+		case OpInsertion:
+			s2Len += run.Length
+		}
+	}
+	return s1Len, s2Len
+}
+
+// greatest common divisor of the absolute values of a and b
+func GCD(a int, b int) int {
+	a = max(a, -a)
+	b = max(b, -b)
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// reverse a string byte by byte
+func ReverseString(s string) string {
+	reversed := make([]byte, len(s))
+	for i := 0; i < len(s); i++ {
+		reversed[len(s)-1-i] = s[i]
+	}
+	return string(reversed)
+}
+
+// MatchLength: the number of leading characters a and b have in common, comparing 8 at a time since the trailing zeros of the XOR of two
+// little-endian words count the bytes which match, and one at a time for the last few
+func MatchLength(a string, b string) int {
+	i := 0
+	for i+8 <= len(a) && i+8 <= len(b) {
+		if x := load64(a, i) ^ load64(b, i); x != 0 {
+			return i + bits.TrailingZeros64(x)/8
+		}
+		i += 8
+	}
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// load64: the 8 bytes of s from i as a little-endian word, which the compiler turns into a single load
+func load64(s string, i int) uint64 {
+	s = s[i : i+8]
+	return uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 | uint64(s[3])<<24 |
+		uint64(s[4])<<32 | uint64(s[5])<<40 | uint64(s[6])<<48 | uint64(s[7])<<56
+}
+
+// append count of op to the run lists Ops, Counts, extending the last run if it is the same op, zero counts are dropped
+func AppendOp(Ops []rune, Counts []uint, op rune, count uint) ([]rune, []uint) {
+	if count == 0 {
+		return Ops, Counts
+	}
+	if Ops[len(Ops)-1] == op {
+		Counts[len(Counts)-1] += count
+		return Ops, Counts
+	}
+	return append(Ops, op), append(Counts, count)
+}
+
 // given the min index, return the item in values at that index
 func SafeMin[T Integer](values []T, idx int) T {
 	return values[idx]
@@ -122,48 +248,40 @@ func NextLoHi(M *WavefrontComponent, I *WavefrontComponent, D *WavefrontComponen
 	return lo, hi
 }
 
-// set the traceback and diag value for the next I wavefront
-func NextI(M *WavefrontComponent, I *WavefrontComponent, score int, k int, penalties Penalty) {
-	o := penalties.O
-	e := penalties.E
-
-	a_ok, a, _ := M.GetVal(score-o-e, k-1)
-	b_ok, b, _ := I.GetVal(score-e, k-1)
+// set the traceback and diag value for the next I wavefront, opening from M at score-o-e or extending I at score-e
+func NextI(M_open *Wavefront, I_extd *Wavefront, I *Wavefront, k int) {
+	a_ok, a := M_open.Offset(k - 1)
+	b_ok, b := I_extd.Offset(k - 1)
 
 	ok, nextITraceback := SafeArgMax([]bool{a_ok, b_ok}, []uint64{a, b})
 	nextIVal := SafeMax([]uint64{a, b}, nextITraceback) + 1 // important that the +1 is here
 	if ok {
-		I.SetVal(score, k, nextIVal, []Traceback{OpenIns, ExtdIns}[nextITraceback])
+		I.Set(k, nextIVal, []Traceback{OpenIns, ExtdIns}[nextITraceback])
 	}
 }
 
-// set the traceback and diag value for the next D wavefront
-func NextD(M *WavefrontComponent, D *WavefrontComponent, score int, k int, penalties Penalty) {
-	o := penalties.O
-	e := penalties.E
-
-	a_ok, a, _ := M.GetVal(score-o-e, k+1)
-	b_ok, b, _ := D.GetVal(score-e, k+1)
+// set the traceback and diag value for the next D wavefront, opening from M at score-o-e or extending D at score-e
+func NextD(M_open *Wavefront, D_extd *Wavefront, D *Wavefront, k int) {
+	a_ok, a := M_open.Offset(k + 1)
+	b_ok, b := D_extd.Offset(k + 1)
 
 	ok, nextDTraceback := SafeArgMax([]bool{a_ok, b_ok}, []uint64{a, b})
 	nextDVal := SafeMax([]uint64{a, b}, nextDTraceback)
 	if ok {
-		D.SetVal(score, k, nextDVal, []Traceback{OpenDel, ExtdDel}[nextDTraceback])
+		D.Set(k, nextDVal, []Traceback{OpenDel, ExtdDel}[nextDTraceback])
 	}
 }
 
-// set the traceback and diag value for the next M wavefront
-func NextM(M *WavefrontComponent, I *WavefrontComponent, D *WavefrontComponent, score int, k int, penalties Penalty) {
-	x := penalties.X
-
-	a_ok, a, _ := M.GetVal(score-x, k)
+// set the traceback and diag value for the next M wavefront, from a mismatch on M at score-x or the I and D wavefronts of the same score
+func NextM(M_sub *Wavefront, I *Wavefront, D *Wavefront, M *Wavefront, k int) {
+	a_ok, a := M_sub.Offset(k)
 	a++ // important to have +1 here
-	b_ok, b, _ := I.GetVal(score, k)
-	c_ok, c, _ := D.GetVal(score, k)
+	b_ok, b := I.Offset(k)
+	c_ok, c := D.Offset(k)
 
 	ok, nextMTraceback := SafeArgMax([]bool{a_ok, b_ok, c_ok}, []uint64{a, b, c})
 	nextMVal := SafeMax([]uint64{a, b, c}, nextMTraceback)
 	if ok {
-		M.SetVal(score, k, nextMVal, []Traceback{Sub, Ins, Del}[nextMTraceback])
+		M.Set(k, nextMVal, []Traceback{Sub, Ins, Del}[nextMTraceback])
 	}
 }
@@ -1,45 +1,351 @@
 package wfa
 
+import (
+	"context"
+	"strings"
+)
+
 // WFAlign takes strings s1, s2, penalties, and returns the score and CIGAR if doCIGAR is true
 func WFAlign(s1 string, s2 string, penalties Penalty, doCIGAR bool) Result {
-	n := len(s1)
-	m := len(s2)
+	return WFAlignWithOptions(s1, s2, penalties, doCIGAR, Options{})
+}
+
+// WFAlignWithOptions: same as WFAlign, with the memory mode and other settings given by options
+// the penalties, options and lengths are not checked, see WFAlignChecked
+func WFAlignWithOptions(s1 string, s2 string, penalties Penalty, doCIGAR bool, options Options) Result {
+	return wfAlignOptions(context.Background(), stringPair{s1: s1, s2: s2}, penalties, doCIGAR, options, nil)
+}
+
+// WFAlignChecked: same as WFAlignWithOptions, returning the error of Validate instead of aligning when the arguments are unsupported
+func WFAlignChecked(s1 string, s2 string, penalties Penalty, doCIGAR bool, options Options) (Result, error) {
+	return wfAlignContext(context.Background(), stringPair{s1: s1, s2: s2}, penalties, doCIGAR, options, nil)
+}
+
+// WFAlignContext: same as WFAlignChecked, giving up once ctx is done with a *CanceledError wrapping ctx.Err()
+// the context is checked between wavefronts and every few thousand characters while extending one
+func WFAlignContext(ctx context.Context, s1 string, s2 string, penalties Penalty, doCIGAR bool, options Options) (Result, error) {
+	return wfAlignContext(ctx, stringPair{s1: s1, s2: s2}, penalties, doCIGAR, options, nil)
+}
+
+// WFAlignSequences: same as WFAlignContext for any Sequences, such as those of StringSequences, DNASequences, TokenSequences or FuncSequences
+func WFAlignSequences(ctx context.Context, seqs Sequences, penalties Penalty, doCIGAR bool, options Options) (Result, error) {
+	return wfAlignContext(ctx, seqs, penalties, doCIGAR, options, nil)
+}
+
+// WFAlignDNA: same as WFAlignChecked for packed sequences, which are extended 32 bases at a time
+func WFAlignDNA(s1 DNA, s2 DNA, penalties Penalty, doCIGAR bool, options Options) (Result, error) {
+	return wfAlignContext(context.Background(), DNASequences(s1, s2), penalties, doCIGAR, options, nil)
+}
+
+// WFAlignTokens: same as WFAlignChecked for slices of any comparable type, such as words, lines or runes, with one CIGAR operation per element
+func WFAlignTokens[T comparable](s1 []T, s2 []T, penalties Penalty, doCIGAR bool, options Options) (Result, error) {
+	return wfAlignContext(context.Background(), TokenSequences(s1, s2), penalties, doCIGAR, options, nil)
+}
+
+// WFAlignFunc: same as WFAlignTokens with elements matching when equal(s1[v], s2[h])
+func WFAlignFunc[T any](s1 []T, s2 []T, equal func(T, T) bool, penalties Penalty, doCIGAR bool, options Options) (Result, error) {
+	return wfAlignContext(context.Background(), FuncSequences(s1, s2, equal), penalties, doCIGAR, options, nil)
+}
+
+// wfAlignContext: WFAlignContext taking the wavefronts from pool, which recovers the *CanceledError WFExtend panics with
+func wfAlignContext(ctx context.Context, seqs Sequences, penalties Penalty, doCIGAR bool, options Options, pool *WavefrontPool) (result Result, err error) {
+	n, m := seqs.Lens()
+	if err := Validate(n, m, penalties, options); err != nil {
+		return Result{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return Result{}, &CanceledError{Err: err}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			canceled, ok := r.(*CanceledError)
+			if !ok {
+				panic(r)
+			}
+			result = Result{}
+			err = canceled
+		}
+	}()
+	return wfAlignOptions(ctx, seqs, penalties, doCIGAR, options, pool), nil
+}
+
+// wfAlignOptions: WFAlignWithOptions taking the wavefronts from pool and returning them to it
+func wfAlignOptions(ctx context.Context, seqs Sequences, penalties Penalty, doCIGAR bool, options Options, pool *WavefrontPool) Result {
+	if options.Span == SpanLocal {
+		return wfAlignLocal(ctx, seqs, penalties, doCIGAR, options, pool)
+	}
+	n, m := seqs.Lens()
+
+	free := EndsFree{}
+	if options.Span == SpanEndsFree && !options.Heuristic.Extension() { // clamp the free ends to the sequences, an extension always starts at the beginning
+		free.S1Begin = min(max(options.EndsFree.S1Begin, 0), n)
+		free.S1End = min(max(options.EndsFree.S1End, 0), n)
+		free.S2Begin = min(max(options.EndsFree.S2Begin, 0), m)
+		free.S2End = min(max(options.EndsFree.S2End, 0), m)
+	}
+
+	p := NewWFPenalties(penalties, options.Distance, free != EndsFree{})
+	bound := MaxInt
+	if options.Bounded && !options.Heuristic.Extension() {
+		bound = p.Bound(options.MaxScore, n+m)
+	}
+
+	var result Result
+	if options.Memory == MemoryUltralow {
+		result = BiWFAlign(ctx, seqs, p, options.Heuristic, bound, doCIGAR, free, pool)
+	} else {
+		result = wfAlign(ctx, seqs, p, options.Heuristic, bound, doCIGAR, ComponentM, ComponentM, free, pool)
+	}
+	if result.Status != StatusOK {
+		return result
+	}
+	length := n + m
+	if options.Heuristic.Extension() { // the characters after the end of an extension are not scored
+		length = result.S1End + result.S2End
+	}
+	if result.Suboptimal && doCIGAR { // the parts of a path a heuristic pieced together may align for less as one CIGAR
+		skipped := result.S1Begin + n - result.S1End + result.S2Begin + m - result.S2End
+		if options.Heuristic.Extension() {
+			skipped = 0
+		}
+		result.Score = p.ScoreCIGAR(result.CIGAR) + p.Skip*skipped
+	}
+	result.Score = p.Score(result.Score, length)
+
+	return result
+}
+
+// wfAlignLocal: best local alignment of s1 and s2, the score only recovers from mismatches and gaps with a match bonus
+// so without one (M >= 0, or DistanceEdit and DistanceIndel) the best local alignment is empty with score 0
+func wfAlignLocal(ctx context.Context, seqs Sequences, penalties Penalty, doCIGAR bool, options Options, pool *WavefrontPool) Result {
+	p := NewWFPenalties(penalties, options.Distance, true)
+	if p.Skip <= 0 {
+		return Result{}
+	}
+	result := wfLocal(ctx, seqs, p, doCIGAR, options.Memory, pool)
+	n, m := seqs.Lens()
+	result.Score = p.Score(result.Score, n+m)
+	return result
+}
+
+// wfAlign: unidirectional alignment keeping every wavefront for the backtrace, or only the last ones in rings without doCIGAR, where the path must begin in component begin and finish in component end
+// and may skip up to free characters at either end of s1, s2 for p.Skip each, or with the X-drop or Z-drop returns the best prefix alignment
+// the alignment is given up with StatusMaxScoreExceeded once its translated score has to exceed bound, the wavefronts are taken from pool and returned to it
+func wfAlign(ctx context.Context, seqs Sequences, p WFPenalties, heuristic Heuristic, bound int, doCIGAR bool, begin Component, end Component, free EndsFree, pool *WavefrontPool) Result {
+	penalties := p.Penalty
+	skip := p.Skip
+	n, m := seqs.Lens()
 	A_k := m - n          // diagonal where both sequences end
 	A_offset := uint64(m) // offset along a_k diagonal corresponding to end
-	score := 0
-	M := NewWavefrontComponent()
-	M.SetLoHi(0, 0, 0)
-	M.SetVal(0, 0, 0, End)
-	I := NewWavefrontComponent()
-	D := NewWavefrontComponent()
+	window := 0
+	if !doCIGAR { // without a backtrace only the wavefronts wfNext reads are kept
+		window = p.MaxStep() + 1
+	}
+	M := pool.Component(window)
+	I := pool.Component(window)
+	D := pool.Component(window)
+	I2 := pool.Component(window)
+	D2 := pool.Component(window)
+	components := []*WavefrontComponent{M, I, D, I2, D2}
+	defer pool.Release(components...)
+	score := WFInit(M, I, D, I2, D2, begin, free, skip, penalties)
+	initial := score
+	E := components[end]
+	tb_s := score
+	tb_k := A_k
+	tb_h := m // offset of the end, read when it is found since a ring may release it later
+	tb_end := end
+	best := MaxInt // lowest score of a path reaching the free ends, including the cost of the characters it skips
+	suboptimal := false
+	drop := NewDropState(score, p.MaxStep())
+	reduce := ReduceState{}
 
 	for {
-		WFExtend(M, s1, n, s2, m, score)
-		ok, val, _ := M.GetVal(score, A_k)
-		if ok && val >= A_offset { // exit when M_(s,a_k) >= A_offset, ie the wavefront has reached the end
-			break
+		WFExtend(ctx, M, seqs, score)
+		if score-initial > bound && best-initial > bound { // every path left to find scores more than bound
+			return Result{Status: StatusMaxScoreExceeded}
+		}
+		if heuristic.Extension() {
+			if WFDrop(components, score, n, m, p, heuristic, &drop) { // exit at the best prefix alignment once the heuristics stop
+				tb_s = drop.WavefrontScore
+				tb_k = drop.K
+				tb_h = drop.Offset
+				suboptimal = suboptimal || drop.Dropped
+				break
+			}
+		} else if free.S1End != 0 || free.S2End != 0 {
+			ok, k, total := WFEndsFreeReached(M, score, n, m, free, skip)
+			if ok && total < best {
+				_, h := M.GetOffset(score, k)
+				best = total
+				tb_s = score
+				tb_k = k
+				tb_h = int(h)
+			}
+			if best <= score { // exit when no later wavefront can reach the free ends for less
+				break
+			}
+		} else {
+			ok, val := E.GetOffset(score, A_k)
+			if ok && val >= A_offset { // exit when E_(s,a_k) >= A_offset, ie the wavefront has reached the end
+				tb_s = score
+				tb_h = int(val)
+				break
+			}
+		}
+		if end != ComponentM { // a path reaching the end in M may still finish in a zero length gap by paying its open
+			ok, val := M.GetOffset(score-p.Open(end), A_k)
+			if ok && val >= A_offset {
+				tb_s = score - p.Open(end)
+				tb_h = int(val)
+				tb_end = ComponentM
+				break
+			}
+		}
+		if heuristic.Reduction != nil && WFReduce(components, score, n, m, free, *heuristic.Reduction, &reduce) {
+			suboptimal = true
 		}
 		score = score + 1
-		WFNext(M, I, D, score, penalties)
+		wfNext(M, I, D, I2, D2, score, p)
+		WFSources(M, score, free, skip)
+	}
+	if best != MaxInt {
+		score = best
+	}
+	if heuristic.Extension() {
+		score = tb_s
+	}
+
+	result := Result{
+		Score:   score - initial,
+		S1Begin: 0,
+		S1End:   tb_h - tb_k,
+		S2Begin: 0,
+		S2End:   tb_h,
+
+		Suboptimal: suboptimal,
 	}
 
-	CIGAR := ""
 	if doCIGAR { // if doCIGAR, then perform backtrace, otherwise just return the score
-		CIGAR = WFBacktrace(M, I, D, score, penalties, A_k, A_offset, s1, s2)
+		if p.Distance.Linear() {
+			result.CIGAR = WFBacktraceLinear(M, tb_s, penalties, tb_k)
+		} else {
+			result.CIGAR = WFBacktrace(M, I, D, I2, D2, tb_s, penalties, tb_k, A_offset, tb_end)
+		}
+		s1Len, s2Len := CIGARLengths(result.CIGAR)
+		result.S1Begin = result.S1End - s1Len
+		result.S2Begin = result.S2End - s2Len
+	} else { // the begin of an ends-free alignment is only known after the backtrace
+		if free.S1Begin != 0 {
+			result.S1Begin = -1
+		}
+		if free.S2Begin != 0 {
+			result.S2Begin = -1
+		}
+	}
+
+	return result
+}
+
+// WFInit: sets the initial wavefront for a path beginning in component begin and returns its score
+// a path beginning in I or D continues a gap which was opened outside of s1, s2, so the gap open is charged up front
+// and the returned score must be subtracted from the final score
+// a path beginning in M may start anywhere within the free begins of s1, s2, those which cost nothing to skip are set here
+func WFInit(M *WavefrontComponent, I *WavefrontComponent, D *WavefrontComponent, I2 *WavefrontComponent, D2 *WavefrontComponent, begin Component, free EndsFree, skip int, penalties Penalty) int {
+	switch begin {
+	case ComponentI:
+		I.SetLoHi(penalties.O, 0, 0)
+		I.SetVal(penalties.O, 0, 0, End)
+		M.SetLoHi(penalties.O, 0, 0)
+		M.SetVal(penalties.O, 0, 0, Ins)
+		return penalties.O
+	case ComponentD:
+		D.SetLoHi(penalties.O, 0, 0)
+		D.SetVal(penalties.O, 0, 0, End)
+		M.SetLoHi(penalties.O, 0, 0)
+		M.SetVal(penalties.O, 0, 0, Del)
+		return penalties.O
+	case ComponentI2:
+		I2.SetLoHi(penalties.O2, 0, 0)
+		I2.SetVal(penalties.O2, 0, 0, End)
+		M.SetLoHi(penalties.O2, 0, 0)
+		M.SetVal(penalties.O2, 0, 0, Ins2)
+		return penalties.O2
+	case ComponentD2:
+		D2.SetLoHi(penalties.O2, 0, 0)
+		D2.SetVal(penalties.O2, 0, 0, End)
+		M.SetLoHi(penalties.O2, 0, 0)
+		M.SetVal(penalties.O2, 0, 0, Del2)
+		return penalties.O2
+	default:
+		lo, hi := -free.S1Begin, free.S2Begin
+		if skip != 0 {
+			lo, hi = 0, 0
+		}
+		// diagonals below 0 skip the start of s1 and begin at offset 0, diagonals above 0 skip the start of s2
+		M.SetLoHi(0, lo, hi)
+		for k := lo; k <= hi; k++ {
+			M.SetVal(0, k, uint64(max(k, 0)), End)
+		}
+		return 0
+	}
+}
+
+// WFSources: adds the free begins which cost score to skip as starting points of wavefront=score
+func WFSources(M *WavefrontComponent, score int, free EndsFree, skip int) {
+	if skip == 0 || score%skip != 0 {
+		return
 	}
+	i := score / skip
+	if i <= free.S1Begin {
+		M.SetSource(score, -i, 0)
+	}
+	if i <= free.S2Begin {
+		M.SetSource(score, i, uint64(i))
+	}
+}
 
-	return Result{
-		Score: score,
-		CIGAR: CIGAR,
+// WFEndsFreeReached: finds the diagonal in wavefront=score which reached the end of s1 or s2 while leaving at most the free ends unaligned,
+// returning the lowest total score after paying skip for each unaligned character
+func WFEndsFreeReached(M *WavefrontComponent, score int, n int, m int, free EndsFree, skip int) (bool, int, int) {
+	found := false
+	best_k := 0
+	best := MaxInt
+	_, lo, hi := M.GetLoHi(score)
+	for k := lo; k <= hi; k++ {
+		ok, uh := M.GetOffset(score, k)
+		if !ok {
+			continue
+		}
+		h := int(uh)
+		v := h - k
+		total := MaxInt
+		if h == m && n-free.S1End <= v && v <= n {
+			total = score + skip*(n-v)
+		} else if v == n && m-free.S2End <= h && h <= m {
+			total = score + skip*(m-h)
+		}
+		if total < best {
+			found = true
+			best_k = k
+			best = total
+		}
 	}
+	return found, best_k, best
 }
 
-func WFExtend(M *WavefrontComponent, s1 string, n int, s2 string, m int, score int) {
+// WFExtend: extends each diagonal of wavefront=score along the matches of seqs
+// panicking with a *CanceledError once ctx is done, which is checked before and every WFExtendCheck characters compared
+func WFExtend(ctx context.Context, M *WavefrontComponent, seqs Sequences, score int) {
+	done := ctx.Done()
+	WFCheck(ctx, done, M, score)
+	compared := 0
 	_, lo, hi := M.GetLoHi(score)
+	wavefront := M.W.Get(score)
 	for k := lo; k <= hi; k++ { // for each diagonal in current wavefront
 		// v = M[score][k] - k
 		// h = M[score][k]
-		ok, uh, tb := M.GetVal(score, k)
+		ok, uh := wavefront.Offset(k)
 		// exit early if M_(s,l) is invalid
 		if !ok {
 			continue
@@ -47,13 +353,43 @@ func WFExtend(M *WavefrontComponent, s1 string, n int, s2 string, m int, score i
 		h := int(uh)
 		v := h - k
 		// in the paper, we do v++, h++, M_(s,k)++
-		// however, note that h = M_(s,k) so instead we just do v++, h++ and set M_(s,k) at the end
+		// however, note that h = M_(s,k) so instead we count the matches and set M_(s,k) at the end
 		// this saves a some memory reads and writes
-		for v < n && h < m && s1[v] == s2[h] { // extend diagonal for the next set of matches
-			v++
-			h++
+		matches := seqs.Matches(v, h) // extend diagonal for the next set of matches
+		wavefront.SetOffset(k, uint64(h+matches))
+		compared = compared + matches + 1
+		if compared >= WFExtendCheck {
+			WFCheck(ctx, done, M, score)
+			compared = 0
 		}
-		M.SetVal(score, k, uint64(h), tb)
+	}
+}
+
+// WFExtendCheck: how many characters WFExtend compares between checks of its context
+const WFExtendCheck = 1 << 16
+
+// WFCheck: panics with a *CanceledError holding the progress at wavefront=score if done, the Done channel of ctx, is closed
+func WFCheck(ctx context.Context, done <-chan struct{}, M *WavefrontComponent, score int) {
+	if done == nil { // ctx can never be canceled
+		return
+	}
+	select {
+	case <-done:
+		_, lo, hi := M.GetLoHi(score)
+		panic(&CanceledError{Err: ctx.Err(), Score: score, Width: hi - lo + 1})
+	default:
+	}
+}
+
+// wfNext: computes wavefront=score with the recurrences of the distance of p, I2 and D2 are only used by DistanceGapAffine2p
+func wfNext(M *WavefrontComponent, I *WavefrontComponent, D *WavefrontComponent, I2 *WavefrontComponent, D2 *WavefrontComponent, score int, p WFPenalties) {
+	switch {
+	case p.Distance.Linear():
+		WFNextLinear(M, score, p.Penalty, p.Distance)
+	case p.Distance == DistanceGapAffine2p:
+		WFNext2p(M, I, D, I2, D2, score, p.Penalty)
+	default:
+		WFNext(M, I, D, score, p.Penalty)
 	}
 }
 
@@ -61,96 +397,94 @@ func WFNext(M *WavefrontComponent, I *WavefrontComponent, D *WavefrontComponent,
 	// get this score's lo, hi
 	lo, hi := NextLoHi(M, I, D, score, penalties)
 
+	// the wavefronts read and written are looked up once rather than for each diagonal
+	M_sub := M.W.Get(score - penalties.X)
+	M_open := M.W.Get(score - penalties.O - penalties.E)
+	I_extd := I.W.Get(score - penalties.E)
+	D_extd := D.W.Get(score - penalties.E)
+	M_next, I_next, D_next := M.W.Get(score), I.W.Get(score), D.W.Get(score)
+
 	for k := lo; k <= hi; k++ { // for each diagonal, extend the matrices for the next wavefronts
-		NextI(M, I, score, k, penalties)
-		NextD(M, D, score, k, penalties)
-		NextM(M, I, D, score, k, penalties)
+		NextI(M_open, I_extd, I_next, k)
+		NextD(M_open, D_extd, D_next, k)
+		NextM(M_sub, I_next, D_next, M_next, k)
 	}
 }
 
-func WFBacktrace(M *WavefrontComponent, I *WavefrontComponent, D *WavefrontComponent, score int, penalties Penalty, A_k int, A_offset uint64, s1 string, s2 string) string {
+// WFBacktrace: walks the tracebacks from component end at wavefront=score, diag=A_k back to the initial wavefront and returns the CIGAR
+func WFBacktrace(M *WavefrontComponent, I *WavefrontComponent, D *WavefrontComponent, I2 *WavefrontComponent, D2 *WavefrontComponent, score int, penalties Penalty, A_k int, A_offset uint64, end Component) string {
 	x := penalties.X
 	o := penalties.O
 	e := penalties.E
+	o2 := penalties.O2
+	e2 := penalties.E2
 
 	tb_s := score
 	tb_k := A_k
 	done := false
 
-	_, current_dist, current_traceback := M.GetVal(tb_s, tb_k)
+	_, current_dist, current_traceback := []*WavefrontComponent{M, I, D, I2, D2}[end].GetVal(tb_s, tb_k)
 
 	Ops := []rune{'~'}
 	Counts := []uint{0}
-	idx := 0
 
 	for !done {
 		switch current_traceback {
 		case OpenIns:
-			if Ops[idx] == 'I' {
-				Counts[idx]++
-			} else {
-				Ops = append(Ops, 'I')
-				Counts = append(Counts, 1)
-				idx++
-			}
+			Ops, Counts = AppendOp(Ops, Counts, 'I', 1)
 
 			tb_s = tb_s - o - e
 			tb_k = tb_k - 1
 			_, current_dist, current_traceback = M.GetVal(tb_s, tb_k)
 		case ExtdIns:
-			if Ops[idx] == 'I' {
-				Counts[idx]++
-			} else {
-				Ops = append(Ops, 'I')
-				Counts = append(Counts, 1)
-				idx++
-			}
+			Ops, Counts = AppendOp(Ops, Counts, 'I', 1)
 
 			tb_s = tb_s - e
 			tb_k = tb_k - 1
 			_, current_dist, current_traceback = I.GetVal(tb_s, tb_k)
 		case OpenDel:
-			if Ops[idx] == 'D' {
-				Counts[idx]++
-			} else {
-				Ops = append(Ops, 'D')
-				Counts = append(Counts, 1)
-				idx++
-			}
+			Ops, Counts = AppendOp(Ops, Counts, 'D', 1)
 
 			tb_s = tb_s - o - e
 			tb_k = tb_k + 1
 			_, current_dist, current_traceback = M.GetVal(tb_s, tb_k)
 		case ExtdDel:
-			if Ops[idx] == 'D' {
-				Counts[idx]++
-			} else {
-				Ops = append(Ops, 'D')
-				Counts = append(Counts, 1)
-				idx++
-			}
+			Ops, Counts = AppendOp(Ops, Counts, 'D', 1)
 
 			tb_s = tb_s - e
 			tb_k = tb_k + 1
 			_, current_dist, current_traceback = D.GetVal(tb_s, tb_k)
+		case OpenIns2:
+			Ops, Counts = AppendOp(Ops, Counts, 'I', 1)
+
+			tb_s = tb_s - o2 - e2
+			tb_k = tb_k - 1
+			_, current_dist, current_traceback = M.GetVal(tb_s, tb_k)
+		case ExtdIns2:
+			Ops, Counts = AppendOp(Ops, Counts, 'I', 1)
+
+			tb_s = tb_s - e2
+			tb_k = tb_k - 1
+			_, current_dist, current_traceback = I2.GetVal(tb_s, tb_k)
+		case OpenDel2:
+			Ops, Counts = AppendOp(Ops, Counts, 'D', 1)
+
+			tb_s = tb_s - o2 - e2
+			tb_k = tb_k + 1
+			_, current_dist, current_traceback = M.GetVal(tb_s, tb_k)
+		case ExtdDel2:
+			Ops, Counts = AppendOp(Ops, Counts, 'D', 1)
+
+			tb_s = tb_s - e2
+			tb_k = tb_k + 1
+			_, current_dist, current_traceback = D2.GetVal(tb_s, tb_k)
 		case Sub:
 			tb_s = tb_s - x
 			// tb_k = tb_k;
 			_, next_dist, next_traceback := M.GetVal(tb_s, tb_k)
 
-			if int(current_dist-next_dist)-1 > 0 {
-				Ops = append(Ops, 'M')
-				Counts = append(Counts, uint(current_dist-next_dist)-1)
-				idx++
-			}
-
-			if Ops[idx] == 'X' {
-				Counts[idx]++
-			} else {
-				Ops = append(Ops, 'X')
-				Counts = append(Counts, 1)
-				idx++
-			}
+			Ops, Counts = AppendOp(Ops, Counts, 'M', uint(current_dist-next_dist)-1)
+			Ops, Counts = AppendOp(Ops, Counts, 'X', 1)
 
 			current_dist = next_dist
 			current_traceback = next_traceback
@@ -159,9 +493,7 @@ func WFBacktrace(M *WavefrontComponent, I *WavefrontComponent, D *WavefrontCompo
 			// tb_k = tb_k;
 			_, next_dist, next_traceback := I.GetVal(tb_s, tb_k)
 
-			Ops = append(Ops, 'M')
-			Counts = append(Counts, uint(current_dist-next_dist))
-			idx++
+			Ops, Counts = AppendOp(Ops, Counts, 'M', uint(current_dist-next_dist))
 
 			current_dist = next_dist
 			current_traceback = next_traceback
@@ -170,26 +502,37 @@ func WFBacktrace(M *WavefrontComponent, I *WavefrontComponent, D *WavefrontCompo
 			// tb_k = tb_k;
 			_, next_dist, next_traceback := D.GetVal(tb_s, tb_k)
 
-			Ops = append(Ops, 'M')
-			Counts = append(Counts, uint(current_dist-next_dist))
-			idx++
+			Ops, Counts = AppendOp(Ops, Counts, 'M', uint(current_dist-next_dist))
+
+			current_dist = next_dist
+			current_traceback = next_traceback
+		case Ins2:
+			_, next_dist, next_traceback := I2.GetVal(tb_s, tb_k)
+
+			Ops, Counts = AppendOp(Ops, Counts, 'M', uint(current_dist-next_dist))
+
+			current_dist = next_dist
+			current_traceback = next_traceback
+		case Del2:
+			_, next_dist, next_traceback := D2.GetVal(tb_s, tb_k)
+
+			Ops, Counts = AppendOp(Ops, Counts, 'M', uint(current_dist-next_dist))
 
 			current_dist = next_dist
 			current_traceback = next_traceback
 		case End:
-			Ops = append(Ops, 'M')
-			Counts = append(Counts, uint(current_dist))
-			idx++
+			// the initial wavefront starts diagonals above 0 at offset k
+			Ops, Counts = AppendOp(Ops, Counts, 'M', uint(current_dist)-uint(max(tb_k, 0)))
 
 			done = true
 		}
 	}
 
-	CIGAR := ""
+	var CIGAR strings.Builder
 	for i := len(Ops) - 1; i > 0; i-- {
-		CIGAR += UIntToString(Counts[i])
-		CIGAR += string(Ops[i])
+		CIGAR.WriteString(UIntToString(Counts[i]))
+		CIGAR.WriteRune(Ops[i])
 	}
 
-	return CIGAR
+	return CIGAR.String()
 }
@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+	wfa "wfa/pkg"
+	"wfa/pkg/seqio"
+)
+
+// BenchmarkScoreOnly: compares the memory of aligning with and without a CIGAR on growing, 99.9% similar sequences
+// the peak-heap metric is the most memory in use during a single alignment, which grows as O(s) without a CIGAR instead of O(s^2)
+func BenchmarkScoreOnly(b *testing.B) {
+	penalties := wfa.Penalty{M: 0, X: 4, O: 6, E: 2}
+	for _, n := range []int{10_000, 100_000, 1_000_000} {
+		s1 := RandomSequence(n)
+		s2 := MutateSequence(s1, 0.001)
+		for _, doCIGAR := range []bool{false, true} {
+			if doCIGAR && n > 100_000 { // keeping every wavefront of a megabase alignment takes too much memory
+				continue
+			}
+			b.Run(fmt.Sprintf("n=%d/cigar=%t", n, doCIGAR), func(b *testing.B) {
+				b.ReportAllocs()
+				peak := uint64(0)
+				for b.Loop() {
+					peak = max(peak, alignPeakHeap(func() { wfa.WFAlignWithOptions(s1, s2, penalties, doCIGAR, wfa.Options{}) }))
+				}
+				b.ReportMetric(float64(peak), "peak-heap-B")
+			})
+		}
+	}
+}
+
+// BenchmarkAligner: compares the allocations of WFAlign with those of an Aligner reusing its wavefronts on short reads
+func BenchmarkAligner(b *testing.B) {
+	penalties := wfa.Penalty{M: 0, X: 4, O: 6, E: 2}
+	for _, n := range []int{150, 1000} {
+		pairs := make([][2]string, 100)
+		for i := range pairs {
+			s1 := RandomSequence(n)
+			pairs[i] = [2]string{s1, MutateSequence(s1, 0.05)}
+		}
+		for _, memory := range []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow} {
+			options := wfa.Options{Memory: memory}
+			b.Run(fmt.Sprintf("n=%d/memory=%d/WFAlign", n, memory), func(b *testing.B) {
+				b.ReportAllocs()
+				i := 0
+				for b.Loop() {
+					wfa.WFAlignWithOptions(pairs[i%len(pairs)][0], pairs[i%len(pairs)][1], penalties, true, options)
+					i++
+				}
+			})
+			b.Run(fmt.Sprintf("n=%d/memory=%d/Aligner", n, memory), func(b *testing.B) {
+				b.ReportAllocs()
+				aligner := wfa.NewAligner(penalties, options)
+				i := 0
+				for b.Loop() {
+					aligner.Align(pairs[i%len(pairs)][0], pairs[i%len(pairs)][1], true)
+					i++
+				}
+			})
+			b.Run(fmt.Sprintf("n=%d/memory=%d/AlignerPool", n, memory), func(b *testing.B) {
+				b.ReportAllocs()
+				pool := sync.Pool{New: func() any { return wfa.NewAligner(penalties, options) }}
+				b.RunParallel(func(pb *testing.PB) {
+					i := 0
+					for pb.Next() {
+						aligner := pool.Get().(*wfa.Aligner)
+						aligner.Align(pairs[i%len(pairs)][0], pairs[i%len(pairs)][1], true)
+						pool.Put(aligner)
+						i++
+					}
+				})
+			})
+		}
+	}
+}
+
+// BenchmarkExtend: aligns sequences of decreasing identity, where the higher it is the more of the time goes to extending diagonals along matches,
+// as strings compared 8 bytes at a time and as DNA compared 32 bases at a time
+func BenchmarkExtend(b *testing.B) {
+	penalties := wfa.Penalty{M: 0, X: 4, O: 6, E: 2}
+	for _, c := range []struct {
+		identity float64
+		n        int
+	}{{0.9, 10_000}, {0.99, 100_000}, {0.999, 100_000}, {1, 100_000}} { // the score of 90% similar sequences grows too fast for longer ones
+		s1 := RandomSequence(c.n)
+		s2 := MutateSequence(s1, 1-c.identity)
+		b.Run(fmt.Sprintf("identity=%g/n=%d", c.identity, c.n), func(b *testing.B) {
+			b.SetBytes(int64(c.n))
+			for b.Loop() {
+				wfa.WFAlignWithOptions(s1, s2, penalties, false, wfa.Options{})
+			}
+		})
+		d1, d2 := wfa.EncodeDNA(s1), wfa.EncodeDNA(s2)
+		b.Run(fmt.Sprintf("identity=%g/n=%d/dna", c.identity, c.n), func(b *testing.B) {
+			b.SetBytes(int64(c.n))
+			for b.Loop() {
+				wfa.WFAlignDNA(d1, d2, penalties, false, wfa.Options{})
+			}
+		})
+	}
+}
+
+// BenchmarkSequences: aligns every pair of the sequences suite, to compare the time and memory of the wavefront storage
+func BenchmarkSequences(b *testing.B) {
+	sequencesFile, err := os.Open(testSequences)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer sequencesFile.Close()
+	sequences, err := seqio.NewPairReader(sequencesFile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	pairs, err := sequences.ReadAll()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	penalties := wfa.Penalty{M: 0, X: 4, O: 6, E: 2}
+	for _, memory := range []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow} {
+		for _, doCIGAR := range []bool{false, true} {
+			b.Run(fmt.Sprintf("memory=%d/cigar=%t", memory, doCIGAR), func(b *testing.B) {
+				b.ReportAllocs()
+				options := wfa.Options{Memory: memory}
+				for b.Loop() {
+					for _, pair := range pairs {
+						wfa.WFAlignWithOptions(pair.S1, pair.S2, penalties, doCIGAR, options)
+					}
+				}
+			})
+		}
+	}
+}
+
+// alignPeakHeap: runs align while sampling the heap in use, returning the most seen above the heap in use before it
+func alignPeakHeap(align func()) uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	base := stats.HeapAlloc
+
+	done := make(chan struct{})
+	peak := make(chan uint64)
+	go func() {
+		var stats runtime.MemStats
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		highest := uint64(0)
+		for {
+			runtime.ReadMemStats(&stats)
+			highest = max(highest, stats.HeapAlloc-min(stats.HeapAlloc, base))
+			select {
+			case <-done:
+				peak <- highest
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	align()
+	close(done)
+	return <-peak
+}
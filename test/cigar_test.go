@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	wfa "wfa/pkg"
+	"wfa/pkg/cigar"
+)
+
+func TestCIGARParse(t *testing.T) {
+	valid := map[string]int{"": 0, "3M1X2I4D": 4, "2H3S5=1X2M4S1H": 7, "1M1M": 2, "10S": 1}
+	for s, runs := range valid {
+		c, err := cigar.Parse(s)
+		if err != nil || len(c) != runs || c.String() != s {
+			t.Fatalf(`test: parse %q, got: %v (%v), expected %d runs`, s, c, err, runs)
+		}
+	}
+	for _, s := range []string{"M", "3M2", "0M", "3M1Z", "3M-1D", "2M3S2M", "2S1H3M", "3M1H2S", "99999999999999999999M"} {
+		if c, err := cigar.Parse(s); !errors.Is(err, cigar.ErrMalformed) {
+			t.Fatalf(`test: parse %q, got: %v (%v), expected: %v`, s, c, err, cigar.ErrMalformed)
+		}
+	}
+}
+
+func TestCIGAR(t *testing.T) {
+	penalties := []wfa.Penalty{{M: 0, X: 4, O: 6, E: 2}, {M: -1, X: 3, O: 4, E: 1}, {M: 0, X: 4, O: 6, E: 2, O2: 24, E2: 1}}
+	for i := range 300 {
+		testPenalties := penalties[i%len(penalties)]
+		options := wfa.Options{}
+		if testPenalties.O2 != 0 {
+			options.Distance = wfa.DistanceGapAffine2p
+		}
+		s1 := RandomSequence(randRange[int](0, 300))
+		s2 := MutateSequence(s1, 0.1)
+		x := wfa.WFAlignWithOptions(s1, s2, testPenalties, true, options)
+		c, err := cigar.Parse(x.CIGAR)
+		if err != nil || c.String() != x.CIGAR {
+			t.Fatalf(`test: CIGAR#%d parse %s, got: %v (%v)`, i, x.CIGAR, c, err)
+		}
+
+		if score, err := c.Score(testPenalties, options.Distance); err != nil || score != x.Score {
+			t.Fatalf(`test: CIGAR#%d score %s, got: %d (%v), expected: %d`, i, x.CIGAR, score, err, x.Score)
+		}
+		if err := c.Verify(s1, s2); err != nil {
+			t.Fatalf(`test: CIGAR#%d verify %s, got: %v`, i, x.CIGAR, err)
+		}
+		if strings.Contains(x.CIGAR, "M") {
+			if err := c.Verify(strings.Repeat("N", len(s1)), s2); !errors.Is(err, cigar.ErrMismatch) {
+				t.Fatalf(`test: CIGAR#%d verify %s against a changed s1, got: %v, expected: %v`, i, x.CIGAR, err, cigar.ErrMismatch)
+			}
+		}
+		if err := c.Verify(s1+"A", s2); !errors.Is(err, cigar.ErrMismatch) {
+			t.Fatalf(`test: CIGAR#%d verify %s against a longer s1, got: %v, expected: %v`, i, x.CIGAR, err, cigar.ErrMismatch)
+		}
+
+		inverted := c.Invert()
+		if score, err := inverted.Score(testPenalties, options.Distance); err != nil || score != x.Score || inverted.Verify(s2, s1) != nil || inverted.Invert().String() != x.CIGAR {
+			t.Fatalf(`test: CIGAR#%d invert %s, got: %s scoring %d (%v)`, i, x.CIGAR, inverted, score, err)
+		}
+
+		split := cigar.CIGAR{}
+		for _, run := range c {
+			for range run.Length {
+				split = append(split, wfa.OpRun{Op: run.Op, Length: 1})
+			}
+		}
+		if split.Merge().String() != x.CIGAR {
+			t.Fatalf(`test: CIGAR#%d merge %s, got: %s`, i, x.CIGAR, split.Merge())
+		}
+
+		extended := c.Extended()
+		collapsed := extended.Collapse()
+		expanded, err := collapsed.Expand(s1, s2)
+		if strings.Contains(extended.String(), "M") || strings.ContainsAny(collapsed.String(), "=X") ||
+			err != nil || expanded.String() != extended.String() || expanded.Native().String() != x.CIGAR {
+			t.Fatalf(`test: CIGAR#%d flavors of %s, got: %s, %s, %s (%v)`, i, x.CIGAR, extended, collapsed, expanded, err)
+		}
+
+		v_begin := randRange[int](0, len(s1)+1)
+		v_end := randRange[int](v_begin, len(s1)+1)
+		sliced, h_begin, h_end := c.Slice(v_begin, v_end)
+		if err := sliced.Verify(s1[v_begin:v_end], s2[h_begin:h_end]); err != nil {
+			t.Fatalf(`test: CIGAR#%d slice [%d:%d] of %s, got: %s, s2[%d:%d] (%v)`, i, v_begin, v_end, x.CIGAR, sliced, h_begin, h_end, err)
+		}
+	}
+}
+
+func TestCIGARClips(t *testing.T) {
+	c, err := cigar.Parse("1H2S3M1I2M1D1X3S")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1 := "ACGTAGC"
+	s2 := "TTACGGTATCCC"
+	if n, m := c.Lens(); n != 7 || m != 12 || c.Verify(s1, s2) != nil {
+		t.Fatalf(`test: clips, got: %d, %d (%v)`, n, m, c.Verify(s1, s2))
+	}
+	if score, err := c.Score(wfa.Penalty{M: 0, X: 4, O: 6, E: 2}, wfa.DistanceGapAffine); err != nil || score != 4+8+8 {
+		t.Fatalf(`test: clips score, got: %d (%v)`, score, err)
+	}
+	if _, err := c.Score(wfa.Penalty{}, wfa.DistanceIndel); !errors.Is(err, cigar.ErrMalformed) {
+		t.Fatalf(`test: clips score of a mismatch under the indel distance, got: %v, expected: %v`, err, cigar.ErrMalformed)
+	}
+	if inverted := c.Invert().String(); inverted != "3M1D2M1I1X" {
+		t.Fatalf(`test: clips invert, got: %s`, inverted)
+	}
+	if sliced, h_begin, h_end := c.Slice(0, 7); sliced.String() != "3M1I2M1D1X" || h_begin != 2 || h_end != 9 {
+		t.Fatalf(`test: clips slice, got: %s, %d, %d`, sliced, h_begin, h_end)
+	}
+	if sliced, h_begin, h_end := c.Slice(3, 3); sliced.String() != "" || h_begin != 6 || h_end != 6 {
+		t.Fatalf(`test: clips empty slice, got: %s, %d, %d`, sliced, h_begin, h_end)
+	}
+	if expanded, err := c.Collapse().Expand(s1, s2); err != nil || expanded.String() != "1H2S3=1I2=1D1X3S" {
+		t.Fatalf(`test: clips expand, got: %s (%v)`, expanded, err)
+	}
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"wfa/pkg/diff"
+)
+
+// applyHunks: text1 with the lines of each hunk replaced by the text2 side of its context and its added lines, which has to give back text2
+func applyHunks(text1 string, hunks []diff.Hunk) string {
+	lines := diff.SplitLines(text1)
+	var s strings.Builder
+	next := 0
+	for _, h := range hunks {
+		for _, line := range lines[next:h.Begin1] {
+			s.WriteString(line)
+		}
+		for _, line := range h.Lines {
+			switch line.Op {
+			case ' ':
+				s.WriteString(line.Text2)
+			case '+':
+				s.WriteString(line.Text)
+			}
+		}
+		next = h.Begin1 + h.Lines1
+	}
+	for _, line := range lines[next:] {
+		s.WriteString(line)
+	}
+	return s.String()
+}
+
+// randomText: n random lines from a few, so that many repeat, without a newline at the end when unterminated
+func randomText(n int, unterminated bool) string {
+	var s strings.Builder
+	for range n {
+		s.WriteString([]string{"a", "b", "c", "{", "}", "\tkey = value", ""}[rand.IntN(7)])
+		s.WriteByte('\n')
+	}
+	if unterminated && n > 0 {
+		return strings.TrimSuffix(s.String(), "\n")
+	}
+	return s.String()
+}
+
+// mutateText: text with about rate of its lines removed, replaced or preceded by an added line
+func mutateText(text string, rate float64) string {
+	var s strings.Builder
+	for _, line := range diff.SplitLines(text) {
+		switch r := rand.Float64(); {
+		case r < rate/3:
+		case r < 2*rate/3:
+			s.WriteString("changed " + line)
+		case r < rate:
+			s.WriteString("added\n" + line)
+		default:
+			s.WriteString(line)
+		}
+	}
+	return s.String()
+}
+
+func TestDiff(t *testing.T) {
+	text1 := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	text2 := "a\nb\nC\nd\ne\nf\ng\nh\ni\nj\nk\nl"
+	expected := "--- old\n+++ new\n@@ -1,6 +1,6 @@\n a\n b\n-c\n+C\n d\n e\n f\n@@ -9,3 +9,4 @@\n i\n j\n k\n+l\n\\ No newline at end of file\n"
+	if got, err := diff.Unified("old", "new", text1, text2, diff.Options{Context: diff.DefaultContext}); err != nil || got != expected {
+		t.Errorf("test unified diff, got:\n%s\nexpected:\n%s", got, expected)
+	}
+	expected = "--- old\n+++ new\n@@ -3 +3 @@\n-c\n+C\n@@ -11,0 +12 @@\n+l\n\\ No newline at end of file\n"
+	if got, err := diff.Unified("old", "new", text1, text2, diff.Options{}); err != nil || got != expected {
+		t.Errorf("test unified diff without context, got:\n%s\nexpected:\n%s", got, expected)
+	}
+	if got, err := diff.Unified("old", "new", text1, text1, diff.Options{Context: diff.DefaultContext}); err != nil || got != "" {
+		t.Errorf("test unified diff of equal texts, got:\n%s", got)
+	}
+
+	for i := range 300 {
+		text1 := randomText(randRange[int](0, 200), i%4 == 0)
+		text2 := mutateText(text1, []float64{0, 0.01, 0.1, 0.5}[i%4])
+		options := diff.Options{Context: i % 5}
+		hunks, err := diff.Diff(text1, text2, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := applyHunks(text1, hunks); got != text2 {
+			t.Fatalf("test diff#%d, applying %v to:\n%s\ngot:\n%s\nexpected:\n%s", i, hunks, text1, got, text2)
+		}
+		for j, h := range hunks {
+			if j > 0 && h.Begin1 <= hunks[j-1].Begin1+hunks[j-1].Lines1 {
+				t.Fatalf("test diff#%d, hunks %v and %v should be joined", i, hunks[j-1], h)
+			}
+		}
+	}
+}
+
+func TestDiffIgnoreWhitespace(t *testing.T) {
+	text1 := "server {\n\tlisten 80;\n\troot /var/www;\n}\n"
+	text2 := "server {\n    listen  80;\n\troot /srv/www;\n}   \n"
+	expected := "--- old\n+++ new\n@@ -1,4 +1,4 @@\n server {\n \tlisten 80;\n-\troot /var/www;\n+\troot /srv/www;\n }\n"
+	if got, err := diff.Unified("old", "new", text1, text2, diff.Options{Context: diff.DefaultContext, IgnoreWhitespace: true}); err != nil || got != expected {
+		t.Errorf("test unified diff ignoring whitespace, got:\n%s\nexpected:\n%s", got, expected)
+	}
+	hunks, err := diff.Diff(text1, text2, diff.Options{})
+	if err != nil || len(hunks) != 1 || hunks[0].Lines1 != 3 || hunks[0].Lines2 != 3 {
+		t.Errorf("test diff with whitespace, got: %v, %v", hunks, err)
+	}
+	if hunks, err := diff.Diff(text1, text2, diff.Options{Context: diff.DefaultContext, IgnoreWhitespace: true}); err != nil || applyHunks(text1, hunks) != text2 {
+		t.Errorf("test applying the diff ignoring whitespace, got: %v, %v", hunks, err)
+	}
+
+	// the last lines only differ in the newline of text2, which the context of text1 cannot show
+	text1 = "a\nb  c\nd"
+	text2 = "x\nb c\nd\n"
+	expected = "--- old\n+++ new\n@@ -1,3 +1,3 @@\n-a\n+x\n b  c\n-d\n\\ No newline at end of file\n+d\n"
+	if got, err := diff.Unified("old", "new", text1, text2, diff.Options{Context: diff.DefaultContext, IgnoreWhitespace: true}); err != nil || got != expected {
+		t.Errorf("test unified diff ignoring whitespace at the end, got:\n%s\nexpected:\n%s", got, expected)
+	}
+	expected = "--- old\n+++ new\n@@ -1,3 +1,3 @@\n-x\n+a\n b c\n-d\n+d\n\\ No newline at end of file\n"
+	if got, err := diff.Unified("old", "new", text2, text1, diff.Options{Context: diff.DefaultContext, IgnoreWhitespace: true}); err != nil || got != expected {
+		t.Errorf("test unified diff ignoring whitespace at the end of text1, got:\n%s\nexpected:\n%s", got, expected)
+	}
+	if hunks, err := diff.Diff(text1, text2, diff.Options{Context: diff.DefaultContext, IgnoreWhitespace: true}); err != nil || applyHunks(text1, hunks) != text2 {
+		t.Errorf("test applying the diff ignoring whitespace at the end, got: %v, %v", hunks, err)
+	}
+}
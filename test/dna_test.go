@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+	wfa "wfa/pkg"
+)
+
+// RandomAmbiguousSequence: a random sequence of n bases where about one in rate is an N or another IUPAC code
+func RandomAmbiguousSequence(n int, rate int) string {
+	s := []byte(RandomSequence(n))
+	for i := range s {
+		if rand.IntN(rate) == 0 {
+			s[i] = "NRYKMn"[rand.IntN(6)]
+		}
+	}
+	return string(s)
+}
+
+// decodedDNA: the string a DNA of s decodes to, in uppercase with every ambiguous base as N
+func decodedDNA(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune("ACGT", r) {
+			return r
+		}
+		if strings.ContainsRune("acgt", r) {
+			return r - 'a' + 'A'
+		}
+		return 'N'
+	}, s)
+}
+
+func TestDNAEncoding(t *testing.T) {
+	complement := strings.NewReplacer("A", "T", "C", "G", "G", "C", "T", "A")
+	for i := range 300 {
+		s := RandomAmbiguousSequence(randRange[int](0, 300), 1+i%20)
+		if i%2 == 0 {
+			s = strings.ToLower(s)
+		}
+		d := wfa.EncodeDNA(s)
+		expected := decodedDNA(s)
+		if d.Len() != len(s) || d.Decode() != expected {
+			t.Fatalf(`test DNA, s: %s, got: %s, expected: %s`, s, d.Decode(), expected)
+		}
+		for j := 0; j < len(s); j++ {
+			if d.Ambiguous(j) != (expected[j] == 'N') || d.Base(j) != expected[j] {
+				t.Fatalf(`test DNA, s: %s, base %d got: %c, expected: %c`, s, j, d.Base(j), expected[j])
+			}
+		}
+
+		begin := randRange[int](0, len(s)+1)
+		end := randRange[int](begin, len(s)+1)
+		if got := d.Slice(begin, end).Decode(); got != expected[begin:end] {
+			t.Fatalf(`test DNA slice [%d:%d], s: %s, got: %s, expected: %s`, begin, end, s, got, expected[begin:end])
+		}
+		reverse := complement.Replace(wfa.ReverseString(expected[begin:end]))
+		if got := d.Slice(begin, end).ReverseComplement().Decode(); got != reverse {
+			t.Fatalf(`test DNA reverse complement [%d:%d], s: %s, got: %s, expected: %s`, begin, end, s, got, reverse)
+		}
+	}
+}
+
+// TestDNA: aligning packed sequences has to give the same results as aligning the strings they decode to
+func TestDNA(t *testing.T) {
+	penalties := []wfa.Penalty{{M: 0, X: 4, O: 6, E: 2}, {M: -1, X: 3, O: 4, E: 1}, {M: 0, X: 4, O: 6, E: 2, O2: 24, E2: 1}}
+	aligner := wfa.NewAligner(wfa.Penalty{}, wfa.Options{})
+	for i := range 200 {
+		testPenalties := penalties[i%len(penalties)]
+		s1 := RandomAmbiguousSequence(randRange[int](0, 400), 50)
+		s2 := MutateSequence(s1, 0.1)
+		if i%3 == 0 { // ambiguous bases on both sides of a match
+			s2 = strings.ReplaceAll(s2, "G", "N")
+		}
+		options := wfa.Options{Memory: []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow}[i%2]}
+		if testPenalties.O2 != 0 {
+			options.Distance = wfa.DistanceGapAffine2p
+		}
+		if i%5 == 0 && testPenalties.M < 0 {
+			options.Span = wfa.SpanLocal
+		}
+		// a view starting within a word
+		d1 := wfa.EncodeDNA("ACG"+s1).Slice(3, 3+len(s1))
+		d2 := wfa.EncodeDNA(s2)
+
+		expected, err := wfa.WFAlignChecked(decodedDNA(s1), decodedDNA(s2), testPenalties, true, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := wfa.WFAlignDNA(d1, d2, testPenalties, true, options)
+		if err != nil || got != expected {
+			t.Fatalf(`test DNA#%d, s1: %s, s2: %s, got: %+v, %v, expected: %+v`, i, s1, s2, got, err, expected)
+		}
+		aligner.Penalties = testPenalties
+		aligner.Options = options
+		got, err = aligner.AlignDNA(d1, d2, true)
+		if err != nil || got != expected {
+			t.Fatalf(`test Aligner DNA#%d, s1: %s, s2: %s, got: %+v, %v, expected: %+v`, i, s1, s2, got, err, expected)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	wfa "wfa/pkg"
+)
+
+// DPAlign: reference gap-affine dynamic programming (Gotoh) returning the optimal score,
+// allowing the first/last free characters of s1 and s2 to be skipped at no cost
+func DPAlign(s1 string, s2 string, penalties wfa.Penalty, free wfa.EndsFree) int {
+	return dpAlign(s1, s2, penalties, [][2]int{{penalties.O, penalties.E}}, free)
+}
+
+// DPAlign2p: same as DPAlign with the two-piece gap-affine penalties, where a gap costs min(O + l*E, O2 + l*E2)
+func DPAlign2p(s1 string, s2 string, penalties wfa.Penalty, free wfa.EndsFree) int {
+	return dpAlign(s1, s2, penalties, [][2]int{{penalties.O, penalties.E}, {penalties.O2, penalties.E2}}, free)
+}
+
+// DPExtend: the best score of an alignment of any prefix of s1 with any prefix of s2
+func DPExtend(s1 string, s2 string, penalties wfa.Penalty) int {
+	H := dpMatrix(s1, s2, penalties, [][2]int{{penalties.O, penalties.E}}, wfa.EndsFree{}, false)
+	best := 0
+	for i := range H {
+		for j := range H[i] {
+			best = min(best, H[i][j])
+		}
+	}
+	return best
+}
+
+// DPLocal: the best score of an alignment of any substring of s1 with any substring of s2 (Smith-Waterman), with one gap piece or two when O2 or E2 is set
+func DPLocal(s1 string, s2 string, penalties wfa.Penalty) int {
+	pieces := [][2]int{{penalties.O, penalties.E}}
+	if penalties.O2 != 0 || penalties.E2 != 0 {
+		pieces = append(pieces, [2]int{penalties.O2, penalties.E2})
+	}
+	H := dpMatrix(s1, s2, penalties, pieces, wfa.EndsFree{}, true)
+	best := 0
+	for i := range H {
+		for j := range H[i] {
+			best = min(best, H[i][j])
+		}
+	}
+	return best
+}
+
+// dpAlign: returns the best score in the last row or column of dpMatrix within the free ends
+func dpAlign(s1 string, s2 string, penalties wfa.Penalty, pieces [][2]int, free wfa.EndsFree) int {
+	n := len(s1)
+	m := len(s2)
+	H := dpMatrix(s1, s2, penalties, pieces, free, false)
+
+	best := wfa.MaxInt
+	for j := m - free.S2End; j <= m; j++ {
+		best = min(best, H[n][j])
+	}
+	for i := n - free.S1End; i <= n; i++ {
+		best = min(best, H[i][m])
+	}
+	return best
+}
+
+// dpMatrix: Gotoh with one pair of I/D matrices for each gap open, extend piece, returning the best score of aligning each pair of prefixes
+// or with local of aligning each pair of suffixes of the prefixes, where an alignment may also begin anywhere
+func dpMatrix(s1 string, s2 string, penalties wfa.Penalty, pieces [][2]int, free wfa.EndsFree, local bool) [][]int {
+	n := len(s1)
+	m := len(s2)
+	inf := wfa.MaxInt / 4
+
+	H := make([][]int, n+1)
+	I := make([][][]int, len(pieces))
+	D := make([][][]int, len(pieces))
+	for i := 0; i <= n; i++ {
+		H[i] = make([]int, m+1)
+	}
+	for g := range pieces {
+		I[g] = make([][]int, n+1)
+		D[g] = make([][]int, n+1)
+		for i := 0; i <= n; i++ {
+			I[g][i] = make([]int, m+1)
+			D[g][i] = make([]int, m+1)
+		}
+	}
+
+	for i := 0; i <= n; i++ {
+		for j := 0; j <= m; j++ {
+			if i == 0 && j == 0 {
+				H[i][j] = 0
+				for g := range pieces {
+					I[g][i][j] = inf
+					D[g][i][j] = inf
+				}
+				continue
+			}
+
+			H[i][j] = inf
+			for g, piece := range pieces {
+				o, e := piece[0], piece[1]
+				I[g][i][j] = inf
+				D[g][i][j] = inf
+				if j > 0 {
+					I[g][i][j] = min(H[i][j-1]+o+e, I[g][i][j-1]+e)
+				}
+				if i > 0 {
+					D[g][i][j] = min(H[i-1][j]+o+e, D[g][i-1][j]+e)
+				}
+				H[i][j] = min(H[i][j], I[g][i][j], D[g][i][j])
+			}
+			if i > 0 && j > 0 {
+				diag := H[i-1][j-1] + penalties.X
+				if s1[i-1] == s2[j-1] {
+					diag = H[i-1][j-1] + penalties.M
+				}
+				H[i][j] = min(H[i][j], diag)
+			}
+			if (j == 0 && i <= free.S1Begin) || (i == 0 && j <= free.S2Begin) || (local && H[i][j] > 0) {
+				H[i][j] = 0
+			}
+		}
+	}
+
+	return H
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	wfa "wfa/pkg"
+	"wfa/pkg/cigar"
+	"wfa/pkg/paf"
+)
+
+// sequencesFromCS: the aligned target and query rebuilt from a long cs:Z difference string
+func sequencesFromCS(cs string) (string, string) {
+	var target, query strings.Builder
+	for i := 0; i < len(cs); {
+		j := i + 1
+		for j < len(cs) && !strings.ContainsRune(":=*+-", rune(cs[j])) {
+			j++
+		}
+		field := cs[i+1 : j]
+		switch cs[i] {
+		case '=':
+			target.WriteString(field)
+			query.WriteString(field)
+		case '*':
+			target.WriteString(strings.ToUpper(field[:1]))
+			query.WriteString(strings.ToUpper(field[1:]))
+		case '+':
+			query.WriteString(strings.ToUpper(field))
+		case '-':
+			target.WriteString(strings.ToUpper(field))
+		}
+		i = j
+	}
+	return target.String(), query.String()
+}
+
+func TestPAF(t *testing.T) {
+	target := "GGGGACGTACGTTAGCATGCATTGACAAAA"
+	query := "TTACGTACCTTAGCAGCATTGTACACC"
+	result := wfa.WFAlignWithOptions(target, query, wfa.Penalty{M: -2, X: 4, O: 4, E: 2}, true, wfa.Options{Span: wfa.SpanLocal})
+	var out strings.Builder
+	w := paf.NewWriter(&out)
+	for _, options := range []paf.Options{{}, {Extended: true, LongCS: true}} {
+		record, err := paf.NewRecord("read1", "chr1", target, query, result, false, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record, err := paf.NewRecord("read1", "chr1", target, query, result, true, paf.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(record); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "read1\t27\t2\t21\t+\tchr1\t30\t4\t24\t18\t20\t255\tNM:i:2\tAS:i:26\tcg:Z:13M1D6M\tcs:Z::6*gc:6-t:6\n" +
+		"read1\t27\t2\t21\t+\tchr1\t30\t4\t24\t18\t20\t255\tNM:i:2\tAS:i:26\tcg:Z:6=1X6=1D6=\tcs:Z:=ACGTAC*gc=TTAGCA-t=GCATTG\n" +
+		"read1\t27\t6\t25\t-\tchr1\t30\t4\t24\t18\t20\t255\tNM:i:2\tAS:i:26\tcg:Z:13M1D6M\tcs:Z::6*gc:6-t:6\n"
+	if out.String() != expected {
+		t.Fatalf("test: PAF, got:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+
+	if _, err := paf.NewRecord("read1", "chr1", target, query, wfa.Result{Status: wfa.StatusMaxScoreExceeded}, false, paf.Options{}); !errors.Is(err, paf.ErrUnaligned) {
+		t.Fatalf("test: PAF unaligned, got: %v, expected: %v", err, paf.ErrUnaligned)
+	}
+	if _, err := paf.NewRecord("read1", "chr1", target, query, wfa.WFAlign(target, query, wfa.Penalty{M: 0, X: 4, O: 6, E: 2}, false), false, paf.Options{}); !errors.Is(err, paf.ErrNoCIGAR) {
+		t.Fatalf("test: PAF without CIGAR, got: %v, expected: %v", err, paf.ErrNoCIGAR)
+	}
+	// a score-only alignment with free ends does not know them
+	if _, err := paf.NewRecord("read1", "chr1", target, query, wfa.Result{Status: wfa.StatusOK, Score: 3, S1Begin: 0, S1End: -1, S2Begin: 0, S2End: -1}, false, paf.Options{}); !errors.Is(err, paf.ErrNoCIGAR) {
+		t.Fatalf("test: PAF with unknown ends, got: %v, expected: %v", err, paf.ErrNoCIGAR)
+	}
+	for _, result := range []wfa.Result{
+		{Status: wfa.StatusOK, CIGAR: "4M", S1Begin: len(target) - 2, S1End: len(target) + 2, S2Begin: 0, S2End: 4},
+		{Status: wfa.StatusOK, CIGAR: "4M", S1Begin: 0, S1End: 4, S2Begin: -4, S2End: 0},
+	} {
+		if _, err := paf.NewRecord("read1", "chr1", target, query, result, false, paf.Options{}); !errors.Is(err, cigar.ErrMismatch) {
+			t.Fatalf("test: PAF out of range s1[%d:%d], s2[%d:%d], got: %v, expected: %v", result.S1Begin, result.S1End, result.S2Begin, result.S2End, err, cigar.ErrMismatch)
+		}
+	}
+	for _, record := range []paf.Record{{QName: "read 1", TName: "chr1", Strand: '+'}, {QName: "read1", TName: "chr1"}} {
+		if err := w.Write(record); !errors.Is(err, paf.ErrInvalidRecord) {
+			t.Fatalf("test: PAF invalid record %+v, got: %v, expected: %v", record, err, paf.ErrInvalidRecord)
+		}
+	}
+
+	// the cs:Z tag of random alignments rebuilds the aligned target and query
+	for i := range 200 {
+		target := RandomSequence(randRange[int](1, 300))
+		query := MutateSequence(target, 0.1)
+		result := wfa.WFAlign(target, query, wfa.Penalty{M: 0, X: 4, O: 6, E: 2}, true)
+		if result.CIGAR == "" {
+			continue
+		}
+		record, err := paf.NewRecord("read", "chr", target, query, result, false, paf.Options{LongCS: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		alignment := result.Alignment()
+		gotTarget, gotQuery := sequencesFromCS(record.Tags[3][len("cs:Z:"):])
+		if gotTarget != target || gotQuery != query || record.Matches != alignment.Matches || record.BlockLen != len(wfa.RunLengthDecode(result.CIGAR)) {
+			t.Fatalf("test: PAF#%d, target: %s, query: %s, got: %+v", i, target, query, record)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	wfa "wfa/pkg"
+	"wfa/pkg/cigar"
+	"wfa/pkg/sam"
+)
+
+// referenceFromMD: the aligned reference rebuilt from the query, CIGAR and MD tag of a record, which has to be where the record places it
+func referenceFromMD(record sam.Record, md string) string {
+	var aligned strings.Builder // the reference with the query characters at the matches and mismatches
+	h := 0
+	for _, run := range record.CIGAR {
+		switch run.Op {
+		case wfa.OpMatch, cigar.OpEqual, wfa.OpMismatch:
+			aligned.WriteString(record.Seq[h : h+run.Length])
+			h = h + run.Length
+		case wfa.OpDeletion:
+			aligned.WriteString(strings.Repeat("^", run.Length))
+		case wfa.OpInsertion, cigar.OpSoftClip:
+			h = h + run.Length
+		}
+	}
+	reference := []byte(aligned.String())
+	v := 0
+	for i := 0; i < len(md); {
+		j := i
+		for j < len(md) && md[j] >= '0' && md[j] <= '9' {
+			j++
+		}
+		matches, _ := strconv.Atoi(md[i:j])
+		v = v + matches
+		i = j
+		if i < len(md) && md[i] == '^' {
+			i++
+		}
+		for i < len(md) && (md[i] < '0' || md[i] > '9') {
+			reference[v] = md[i]
+			v++
+			i++
+		}
+	}
+	return string(reference)
+}
+
+func TestSAM(t *testing.T) {
+	reference := "GGGGACGTACGTTAGCATGCATTGACAAAA"
+	query := "TTACGTACCTTAGCAGCATTGTACACC"
+	result := wfa.WFAlignWithOptions(reference, query, wfa.Penalty{M: -2, X: 4, O: 4, E: 2}, true, wfa.Options{Span: wfa.SpanLocal})
+	var out strings.Builder
+	w := sam.NewWriter(&out)
+	err := w.WriteHeader(sam.Header{
+		SortOrder:  "unsorted",
+		References: []sam.Reference{{Name: "chr1", Length: len(reference)}},
+		Programs:   []sam.Program{{ID: "wfa", Name: "wfa", CommandLine: "wfa align"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, extended := range []bool{true, false} {
+		record, err := sam.NewRecord("read1", "chr1", reference, query, result, extended)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unmapped, err := sam.NewRecord("read2", "chr1", reference, "ACGT", wfa.Result{Status: wfa.StatusMaxScoreExceeded}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unmapped.Qual = "IIII"
+	if err := w.Write(unmapped); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "@HD\tVN:1.6\tSO:unsorted\n@SQ\tSN:chr1\tLN:30\n@PG\tID:wfa\tPN:wfa\tCL:wfa align\n" +
+		"read1\t0\tchr1\t5\t255\t2S6=1X6=1D6=6S\t*\t0\t0\tTTACGTACCTTAGCAGCATTGTACACC\t*\tNM:i:2\tMD:Z:6G6^T6\tAS:i:26\n" +
+		"read1\t0\tchr1\t5\t255\t2S13M1D6M6S\t*\t0\t0\tTTACGTACCTTAGCAGCATTGTACACC\t*\tNM:i:2\tMD:Z:6G6^T6\tAS:i:26\n" +
+		"read2\t4\t*\t0\t0\t*\t*\t0\t0\tACGT\tIIII\n"
+	if out.String() != expected {
+		t.Fatalf("test: SAM, got:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+
+	if _, err := sam.NewRecord("read1", "chr1", reference, query, wfa.WFAlignWithOptions(reference, query, wfa.Penalty{M: -2, X: 4, O: 4, E: 2}, false, wfa.Options{Span: wfa.SpanLocal}), true); !errors.Is(err, sam.ErrNoCIGAR) {
+		t.Fatalf("test: SAM without CIGAR, got: %v, expected: %v", err, sam.ErrNoCIGAR)
+	}
+	// a score-only alignment with free ends does not know them
+	if _, err := sam.NewRecord("read1", "chr1", reference, query, wfa.Result{Status: wfa.StatusOK, Score: 3, S1Begin: 0, S1End: -1, S2Begin: 0, S2End: -1}, true); !errors.Is(err, sam.ErrNoCIGAR) {
+		t.Fatalf("test: SAM with unknown ends, got: %v, expected: %v", err, sam.ErrNoCIGAR)
+	}
+	for _, result := range []wfa.Result{
+		{Status: wfa.StatusOK, CIGAR: "4M", S1Begin: len(reference) - 2, S1End: len(reference) + 2, S2Begin: 0, S2End: 4},
+		{Status: wfa.StatusOK, CIGAR: "4M", S1Begin: -4, S1End: 0, S2Begin: 0, S2End: 4},
+		{Status: wfa.StatusOK, CIGAR: "4M", S1Begin: 0, S1End: 4, S2Begin: len(query), S2End: len(query) + 4},
+	} {
+		if _, err := sam.NewRecord("read1", "chr1", reference, query, result, true); !errors.Is(err, cigar.ErrMismatch) {
+			t.Fatalf("test: SAM out of range s1[%d:%d], s2[%d:%d], got: %v, expected: %v", result.S1Begin, result.S1End, result.S2Begin, result.S2End, err, cigar.ErrMismatch)
+		}
+	}
+	for _, record := range []sam.Record{{QName: "read 1"}, {QName: "read1", RName: "chr\t1"}, {QName: "read1", Seq: "ACGT", Qual: "II"}} {
+		if err := w.Write(record); !errors.Is(err, sam.ErrInvalidRecord) {
+			t.Fatalf("test: SAM invalid record %+v, got: %v, expected: %v", record, err, sam.ErrInvalidRecord)
+		}
+	}
+
+	// the MD and NM tags of random alignments describe the reference they are placed on
+	penalties := []wfa.Penalty{{M: 0, X: 4, O: 6, E: 2}, {M: -2, X: 4, O: 4, E: 2}}
+	for i := range 200 {
+		testPenalties := penalties[i%len(penalties)]
+		options := wfa.Options{}
+		reference := RandomSequence(randRange[int](1, 300))
+		query := MutateSequence(reference, 0.1)
+		if testPenalties.M < 0 {
+			options.Span = wfa.SpanLocal
+			query = RandomSequence(randRange[int](0, 20)) + MutateSequence(reference[len(reference)/4:], 0.1) + RandomSequence(randRange[int](0, 20))
+		}
+		result := wfa.WFAlignWithOptions(reference, query, testPenalties, true, options)
+		record, err := sam.NewRecord("read", "chr", reference, query, result, i%3 != 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Flag&sam.FlagUnmapped != 0 {
+			continue
+		}
+		tags := map[string]string{}
+		for _, tag := range record.Tags {
+			tags[tag[:2]] = tag[5:]
+		}
+		n, m := record.CIGAR.Lens()
+		aligned := reference[record.Pos-1 : record.Pos-1+n]
+		edits := 0
+		for _, op := range wfa.RunLengthDecode(result.CIGAR) {
+			if op != 'M' {
+				edits++
+			}
+		}
+		if m != len(query) || referenceFromMD(record, tags["MD"]) != aligned || tags["NM"] != strconv.Itoa(edits) || tags["AS"] != strconv.Itoa(-result.Score) {
+			t.Fatalf("test: SAM#%d, reference: %s, query: %s, got: %+v", i, reference, query, record)
+		}
+	}
+}
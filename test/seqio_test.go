@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	wfa "wfa/pkg"
+	"wfa/pkg/seqio"
+)
+
+// randomRecords: n records with random names, descriptions, sequences and qualities, some of which start with @ or +
+func randomRecords(n int, fastq bool) []seqio.Record {
+	records := make([]seqio.Record, n)
+	for i := range records {
+		records[i] = seqio.Record{Name: "read" + RandomSequence(5), Seq: RandomSequence(randRange[int](0, 200))}
+		if i%2 == 0 {
+			records[i].Description = "length=" + wfa.UIntToString(uint(len(records[i].Seq))) + "\tsample A"
+		}
+		if fastq {
+			qual := make([]byte, len(records[i].Seq))
+			for j := range qual {
+				qual[j] = byte(randRange[int]('!', 'J'+1))
+			}
+			records[i].Qual = string(qual)
+		}
+	}
+	return records
+}
+
+func TestSeqIO(t *testing.T) {
+	for i := range 24 {
+		format := []seqio.Format{seqio.FormatFASTA, seqio.FormatFASTQ}[i%2]
+		width := []int{0, 1, 7, 60}[i/2%4]
+		compressed := i/8 == 1
+		records := randomRecords(randRange[int](0, 50), format == seqio.FormatFASTQ)
+
+		var buffer bytes.Buffer
+		var out io.Writer = &buffer
+		var compressor *gzip.Writer
+		if compressed {
+			compressor = gzip.NewWriter(&buffer)
+			out = compressor
+		}
+		w := seqio.NewWriter(out, format, width)
+		for _, record := range records {
+			if err := w.Write(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if compressor != nil {
+			compressor.Close()
+		}
+		input := buffer.String()
+		if i/8 == 2 { // Windows line endings
+			input = strings.ReplaceAll(input, "\n", "\r\n")
+		}
+
+		r, err := seqio.NewReader(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := r.ReadAll()
+		if err != nil || len(got) != len(records) {
+			t.Fatalf("test: seqio#%d, got %d records (%v), expected %d", i, len(got), err, len(records))
+		}
+		for j := range records {
+			if got[j] != records[j] {
+				t.Fatalf("test: seqio#%d record %d, got: %+v, expected: %+v", i, j, got[j], records[j])
+			}
+		}
+	}
+
+	// qualities over several lines starting with @ and +, and blank lines between records
+	r, err := seqio.NewReader(strings.NewReader("@r1 first read\nACGT\nAC\n+r1\n@@II\n+I\n\n>r2\nAC\n\nGT\n>r3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.ReadAll()
+	expected := []seqio.Record{{Name: "r1", Description: "first read", Seq: "ACGTAC", Qual: "@@II+I"}, {Name: "r2", Seq: "ACGT"}, {Name: "r3"}}
+	if err != nil || len(got) != len(expected) || got[0] != expected[0] || got[1] != expected[1] || got[2] != expected[2] {
+		t.Fatalf("test: seqio multiline, got: %+v (%v), expected: %+v", got, err, expected)
+	}
+
+	for _, input := range []string{"ACGT\n", "@r1\nACGT\n", "@r1\nACGT\n+\nII\n", "@r1\nACGT\n+\nIIIII\n"} {
+		r, err := seqio.NewReader(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.ReadAll(); !errors.Is(err, seqio.ErrFormat) {
+			t.Fatalf("test: seqio malformed %q, got: %v, expected: %v", input, err, seqio.ErrFormat)
+		}
+	}
+	w := seqio.NewWriter(io.Discard, seqio.FormatFASTQ, 0)
+	for _, record := range []seqio.Record{{Seq: "ACGT", Qual: "IIII"}, {Name: "r 1"}, {Name: "r1", Seq: "ACGT"}} {
+		if err := w.Write(record); !errors.Is(err, seqio.ErrFormat) {
+			t.Fatalf("test: seqio write %+v, got: %v, expected: %v", record, err, seqio.ErrFormat)
+		}
+	}
+}
+
+func TestPairReader(t *testing.T) {
+	content, err := os.ReadFile(testSequences)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+
+	var compressed bytes.Buffer
+	compressor := gzip.NewWriter(&compressed)
+	compressor.Write(content)
+	compressor.Close()
+	for _, input := range []io.Reader{bytes.NewReader(content), &compressed} {
+		r, err := seqio.NewPairReader(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pairs, err := r.ReadAll()
+		if err != nil || 2*len(pairs) != len(lines) {
+			t.Fatalf("test: pairs, got %d pairs (%v), expected %d", len(pairs), err, len(lines)/2)
+		}
+		for i, pair := range pairs {
+			if pair.ID != i || ">"+pair.S1 != lines[2*i] || "<"+pair.S2 != lines[2*i+1] {
+				t.Fatalf("test: pair %d, got: %+v", i, pair)
+			}
+		}
+	}
+
+	for _, input := range []string{"<ACGT\n>ACGT\n", ">ACGT\n", ">ACGT\n>ACGT\n"} {
+		r, err := seqio.NewPairReader(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.ReadAll(); !errors.Is(err, seqio.ErrFormat) {
+			t.Fatalf("test: pairs malformed %q, got: %v, expected: %v", input, err, seqio.ErrFormat)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"testing"
+	wfa "wfa/pkg"
+)
+
+// tokensOf: the tokens of alphabet which the bases of s stand for, A, C, G and T being the first four
+func tokensOf[T any](s string, alphabet [4]T) []T {
+	tokens := make([]T, len(s))
+	for i := 0; i < len(s); i++ {
+		tokens[i] = alphabet[strings.IndexByte("ACGT", s[i])]
+	}
+	return tokens
+}
+
+// TestTokens: aligning words, runes, residues and ints has to give the same results as aligning the bases they stand for
+func TestTokens(t *testing.T) {
+	penalties := []wfa.Penalty{{M: 0, X: 4, O: 6, E: 2}, {M: -1, X: 3, O: 4, E: 1}, {M: 0, X: 4, O: 6, E: 2, O2: 24, E2: 1}}
+	aligner := wfa.NewAligner(wfa.Penalty{}, wfa.Options{})
+	words := [4]string{"the", "cat", "sat", "mat"}
+	for i := range 200 {
+		testPenalties := penalties[i%len(penalties)]
+		s1 := RandomSequence(randRange[int](0, 300))
+		s2 := MutateSequence(s1, 0.1)
+		options := wfa.Options{Memory: []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow}[i%2]}
+		if testPenalties.O2 != 0 {
+			options.Distance = wfa.DistanceGapAffine2p
+		}
+		if i%5 == 0 && testPenalties.M < 0 {
+			options.Span = wfa.SpanLocal
+		}
+		expected, err := wfa.WFAlignChecked(s1, s2, testPenalties, true, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results := map[string]func() (wfa.Result, error){
+			"words": func() (wfa.Result, error) {
+				return wfa.WFAlignTokens(tokensOf(s1, words), tokensOf(s2, words), testPenalties, true, options)
+			},
+			"runes": func() (wfa.Result, error) {
+				return wfa.WFAlignTokens(tokensOf(s1, [4]rune{'α', 'β', 'γ', 'δ'}), tokensOf(s2, [4]rune{'α', 'β', 'γ', 'δ'}), testPenalties, true, options)
+			},
+			"ints": func() (wfa.Result, error) {
+				return wfa.WFAlignTokens(tokensOf(s1, [4]int{-1, 1 << 40, 7, 256}), tokensOf(s2, [4]int{-1, 1 << 40, 7, 256}), testPenalties, true, options)
+			},
+			"equal": func() (wfa.Result, error) { // words of s2 in random case, matching regardless of it
+				w2 := tokensOf(s2, words)
+				for j := range w2 {
+					if rand.IntN(2) == 0 {
+						w2[j] = strings.ToUpper(w2[j])
+					}
+				}
+				return wfa.WFAlignFunc(tokensOf(s1, words), w2, strings.EqualFold, testPenalties, true, options)
+			},
+			"aligner": func() (wfa.Result, error) {
+				aligner.Penalties = testPenalties
+				aligner.Options = options
+				return aligner.AlignSequences(context.Background(), wfa.TokenSequences(tokensOf(s1, words), tokensOf(s2, words)), true)
+			},
+		}
+		for name, align := range results {
+			got, err := align()
+			if err != nil || got != expected {
+				t.Fatalf(`test tokens %s#%d, s1: %s, s2: %s, got: %+v, %v, expected: %+v`, name, i, s1, s2, got, err, expected)
+			}
+		}
+	}
+}
+
+// TestProteins: residues of the same class match with WFAlignFunc, where == sees substitutions
+func TestProteins(t *testing.T) {
+	classes := []string{"ILMV", "FWY", "KRH", "DE", "STNQ", "AG", "C", "P"}
+	class := func(residue byte) int {
+		for i, residues := range classes {
+			if strings.IndexByte(residues, residue) >= 0 {
+				return i
+			}
+		}
+		return -1
+	}
+	sameClass := func(a byte, b byte) bool {
+		return class(a) == class(b)
+	}
+	s1 := []byte("MKTAYIAKQRQISFVKSHFSRQ")
+	s2 := []byte("MRTAYLAKQRQVSFVRSHFSRQ")
+	penalties := wfa.Penalty{M: 0, X: 4, O: 6, E: 2}
+
+	got, err := wfa.WFAlignTokens(s1, s2, penalties, true, wfa.Options{})
+	if err != nil || got.Score != 16 || got.CIGAR != "1M1X3M1X5M1X3M1X6M" {
+		t.Errorf(`test proteins ==, got: %+v, %v`, got, err)
+	}
+	got, err = wfa.WFAlignFunc(s1, s2, sameClass, penalties, true, wfa.Options{})
+	if err != nil || got.Score != 0 || got.CIGAR != "22M" {
+		t.Errorf(`test proteins by class, got: %+v, %v`, got, err)
+	}
+}
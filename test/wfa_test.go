@@ -2,14 +2,20 @@ package tests
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"math/rand/v2"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 	wfa "wfa/pkg"
+	"wfa/pkg/cigar"
+	"wfa/pkg/seqio"
 
 	"github.com/schollz/progressbar/v3"
 	"golang.org/x/exp/constraints"
@@ -34,20 +40,6 @@ func randRange[T constraints.Integer](min, max int) T {
 	return T(rand.IntN(max-min) + min)
 }
 
-func TestWavefrontPacking(t *testing.T) {
-	for range 1000 {
-		val := randRange[uint64](0, 1000)
-		tb := wfa.Traceback(randRange[uint64](0, 7))
-		v := wfa.PackWavefrontValue(val, tb)
-
-		valid, gotVal, gotTB := wfa.UnpackWavefrontValue(v)
-
-		if !valid || gotVal != val || gotTB != tb {
-			t.Errorf(`test WavefrontPack/Unpack, val: %d, tb: %d, packedval: %x, gotok: %t, gotval: %d, gottb: %d\n`, val, tb, v, valid, gotVal, gotTB)
-		}
-	}
-}
-
 func TestLoHiPacking(t *testing.T) {
 	for range 1000 {
 		lo := randRange[int](-1000, 1000)
@@ -60,74 +52,182 @@ func TestLoHiPacking(t *testing.T) {
 			t.Errorf(`test WavefrontPack/Unpack, lo: %d, hi: %d, packedval: %x, gotlo: %d, gothi: %d`, lo, hi, v, gotLo, gotHi)
 		}
 	}
+
+	// diagonals past 32 bits, as reached by sequences longer than 2^31
+	bounds := []int{-wfa.MaxSequenceLength, -1 << 32, -1<<31 - 1, -1 << 31, 1<<31 - 1, 1 << 31, 1 << 32, wfa.MaxSequenceLength}
+	for _, lo := range bounds {
+		for _, hi := range bounds {
+			gotLo, gotHi := wfa.UnpackWavefrontLoHi(wfa.PackWavefrontLoHi(lo, hi))
+			if gotLo != lo || gotHi != hi {
+				t.Errorf(`test WavefrontPack/Unpack, lo: %d, hi: %d, gotlo: %d, gothi: %d`, lo, hi, gotLo, gotHi)
+			}
+		}
+	}
+
+	// a wavefront component around such diagonals and offsets
+	M := wfa.NewWavefrontComponent()
+	for _, k := range bounds {
+		M.SetLoHi(0, k-1, k+1)
+		M.SetVal(0, k, uint64(wfa.MaxSequenceLength), wfa.Sub)
+		ok, lo, hi := M.GetLoHi(0)
+		valid, val, tb := M.GetVal(0, k)
+		invalid, _, _ := M.GetVal(0, k+1)
+		if !ok || lo != k-1 || hi != k+1 || !valid || val != uint64(wfa.MaxSequenceLength) || tb != wfa.Sub || invalid {
+			t.Errorf(`test WavefrontComponent, k: %d, got lo: %d, hi: %d, val: %d, tb: %d`, k, lo, hi, val, tb)
+		}
+	}
 }
 
-func GetScoreFromCIGAR(CIGAR string, penalties wfa.Penalty) int {
-	unpackedCIGAR := wfa.RunLengthDecode(CIGAR)
-	previousOp := '~'
-	score := 0
-	for _, Op := range unpackedCIGAR {
-		if Op == 'M' {
-			score = score + penalties.M
-		} else if Op == 'X' {
-			score = score + penalties.X
-		} else if (Op == 'I' && previousOp != 'I') || (Op == 'D' && previousOp != 'D') {
-			score = score + penalties.O + penalties.E
-		} else if (Op == 'I' && previousOp == 'I') || (Op == 'D' && previousOp == 'D') {
-			score = score + penalties.E
+func TestWavefrontStorage(t *testing.T) {
+	type cell struct {
+		val uint64
+		tb  wfa.Traceback
+	}
+	for i := range 200 {
+		lo := randRange[int](-50, 50)
+		hi := lo + randRange[int](0, 100)
+		b := wfa.NewWavefront(lo, hi)
+		expected := map[int]cell{}
+		for range randRange[int](1, 200) {
+			k := randRange[int](lo, hi+1)
+			c := cell{val: randRange[uint64](0, 1000), tb: wfa.Traceback(randRange[uint64](0, 16))}
+			if i%4 == 0 && rand.IntN(20) == 0 { // an offset past 32 bits moves the whole wavefront to 64 bits
+				c.val = 1<<32 + c.val
+			}
+			b.Set(k, c.val, c.tb)
+			expected[k] = c
+		}
+		if i%2 == 0 { // trimming keeps the diagonals left, including their tracebacks
+			trim_lo := randRange[int](lo, hi+1)
+			trim_hi := randRange[int](trim_lo, hi+1)
+			M := wfa.NewWavefrontComponent()
+			M.W.Set(0, b)
+			M.TrimLoHi(0, trim_lo, trim_hi)
+			for k := range expected {
+				if k < trim_lo || k > trim_hi {
+					delete(expected, k)
+				}
+			}
+		}
+		for k := lo - 2; k <= hi+2; k++ {
+			valid, val, tb := b.Get(k)
+			c, ok := expected[k]
+			if valid != ok || (ok && (val != c.val || tb != c.tb)) {
+				t.Errorf(`test Wavefront, k: %d, got valid: %t, val: %d, tb: %d, expected valid: %t, val: %d, tb: %d`, k, valid, val, tb, ok, c.val, c.tb)
+			}
+		}
+	}
+
+	// rings keep no tracebacks, reading End, and reuse wavefronts without leaking old offsets
+	R := wfa.NewWavefrontRing(2)
+	for score := range 8 {
+		R.SetLoHi(score, -score, score)
+		R.SetVal(score, score, uint64(score), wfa.Sub)
+		for k := -score; k <= score; k++ {
+			valid, val, tb := R.GetVal(score, k)
+			if valid != (k == score) || (valid && (val != uint64(score) || tb != wfa.End)) {
+				t.Errorf(`test Wavefront ring, score: %d, k: %d, got valid: %t, val: %d, tb: %d`, score, k, valid, val, tb)
+			}
 		}
-		previousOp = Op
 	}
-	return score
 }
 
-func CheckCIGARCorrectness(s1 string, s2 string, CIGAR string) bool {
-	unpackedCIGAR := wfa.RunLengthDecode(CIGAR)
-	i := 0
-	j := 0
+// CheckCIGAR: parses CIGAR and checks that it scores score under penalties and distance and aligns s1 with s2
+func CheckCIGAR(CIGAR string, penalties wfa.Penalty, distance wfa.Distance, score int, s1 string, s2 string) error {
+	c, err := cigar.Parse(CIGAR)
+	if err != nil {
+		return err
+	}
+	if got, err := c.Score(penalties, distance); err != nil || got != score {
+		return fmt.Errorf("CIGAR %s scores %d (%v), expected %d", CIGAR, got, err, score)
+	}
+	return c.Verify(s1, s2)
+}
 
-	s1Aligned := strings.Builder{}
-	alignment := strings.Builder{}
-	s2Aligned := strings.Builder{}
+func TestMatchLength(t *testing.T) {
+	for i := range 2000 {
+		a := RandomSequence(randRange[int](0, 40))
+		b := []byte(a[:randRange[int](0, len(a)+1)])
+		if len(b) > 0 && i%3 != 0 { // a mismatch anywhere within or across the words compared
+			b[rand.IntN(len(b))] = 'N'
+		}
+		expected := 0
+		for expected < len(a) && expected < len(b) && a[expected] == b[expected] {
+			expected++
+		}
+		if got := wfa.MatchLength(a, string(b)); got != expected {
+			t.Errorf(`test MatchLength, a: %s, b: %s, got: %d, expected: %d`, a, b, got, expected)
+		}
+	}
+}
 
-	for c := 0; c < len(unpackedCIGAR); c++ {
-		Op := unpackedCIGAR[c]
-		if Op == 'M' {
-			s1Aligned.WriteByte(s1[i])
-			alignment.WriteRune('|')
-			s2Aligned.WriteByte(s2[j])
-			i++
-			j++
-		} else if Op == 'X' {
-			s1Aligned.WriteByte(s1[i])
-			alignment.WriteRune(' ')
-			s2Aligned.WriteByte(s2[j])
-			i++
-			j++
-		} else if Op == 'I' {
+func TestWFA(t *testing.T) {
+	RunTestSuites(t, wfa.Options{})
+}
+
+func TestBiWFA(t *testing.T) {
+	RunTestSuites(t, wfa.Options{Memory: wfa.MemoryUltralow})
+}
 
-			s1Aligned.WriteRune('-')
-			alignment.WriteRune(' ')
-			s2Aligned.WriteByte(s2[j])
+func RandomSequence(n int) string {
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = "ACGT"[rand.IntN(4)]
+	}
+	return string(s)
+}
 
-			j++
-		} else if Op == 'D' {
-			s1Aligned.WriteByte(s1[i])
-			alignment.WriteRune('|')
-			s2Aligned.WriteRune('-')
-			i++
+// MutateSequence: applies substitutions, insertions and deletions to s, each with probability rate/3 per base
+func MutateSequence(s string, rate float64) string {
+	mutated := []byte{}
+	for i := 0; i < len(s); i++ {
+		r := rand.Float64()
+		if r < rate/3 {
+			mutated = append(mutated, "ACGT"[rand.IntN(4)])
+		} else if r < 2*rate/3 {
+			mutated = append(mutated, s[i], "ACGT"[rand.IntN(4)])
+		} else if r >= rate {
+			mutated = append(mutated, s[i])
 		}
 	}
+	return string(mutated)
+}
 
-	if i == len(s1) && j == len(s2) {
-		return true
-	} else {
-		log.Printf("\n%s\n%s\n%s\n i=%d, j=%d, |s1|=%d, |s2|=%d\n", s1Aligned.String(), alignment.String(), s2Aligned.String(), i, j, len(s1), len(s2))
-		return false
+func TestEndsFree(t *testing.T) {
+	penalties := []wfa.Penalty{{M: 0, X: 1, O: 2, E: 1}, {M: 0, X: 3, O: 1, E: 4}, {M: 0, X: 5, O: 3, E: 2}}
+	for i := range 300 {
+		testPenalties := penalties[i%len(penalties)]
+		// embed a mutated copy of s1 in random flanks so that skipping the ends pays off
+		s1 := RandomSequence(randRange[int](0, 200))
+		s2 := RandomSequence(randRange[int](0, 50)) + MutateSequence(s1, 0.1) + RandomSequence(randRange[int](0, 50))
+		if i%2 == 1 {
+			s1, s2 = s2, s1
+		}
+		free := wfa.EndsFree{
+			S1Begin: randRange[int](0, len(s1)+1),
+			S1End:   randRange[int](0, len(s1)+1),
+			S2Begin: randRange[int](0, len(s2)+1),
+			S2End:   randRange[int](0, len(s2)+1),
+		}
+		expectedScore := DPAlign(s1, s2, testPenalties, free)
+
+		for _, memory := range []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow} {
+			x := wfa.WFAlignWithOptions(s1, s2, testPenalties, true, wfa.Options{Memory: memory, Span: wfa.SpanEndsFree, EndsFree: free})
+
+			if x.Score != expectedScore {
+				t.Fatalf(`test: endsfree#%d, memory: %d, s1: %s, s2: %s, free: %v, got: %d, expected: %d`, i, memory, s1, s2, free, x.Score, expectedScore)
+			}
+			if x.S1Begin > free.S1Begin || x.S2Begin > free.S2Begin || len(s1)-x.S1End > free.S1End || len(s2)-x.S2End > free.S2End {
+				t.Fatalf(`test: endsfree#%d, memory: %d, free: %v, got coordinates s1[%d:%d], s2[%d:%d]`, i, memory, free, x.S1Begin, x.S1End, x.S2Begin, x.S2End)
+			}
+			if CheckCIGAR(x.CIGAR, testPenalties, wfa.DistanceGapAffine, x.Score, s1[x.S1Begin:x.S1End], s2[x.S2Begin:x.S2End]) != nil {
+				t.Fatalf(`test: endsfree#%d, memory: %d, s1: %s, s2: %s, free: %v, got: [%s] for s1[%d:%d], s2[%d:%d]`, i, memory, s1, s2, free, x.CIGAR, x.S1Begin, x.S1End, x.S2Begin, x.S2End)
+			}
+		}
 	}
 }
 
-func TestWFA(t *testing.T) {
+func RunTestSuites(t *testing.T, options wfa.Options) {
 	content, _ := os.ReadFile(testJsonPath)
 
 	var testMap map[string]TestCase
@@ -143,9 +243,20 @@ func TestWFA(t *testing.T) {
 			E: v.Penalties.E,
 		}
 
-		sequencesFile, _ := os.Open(testSequences)
-		sequences := bufio.NewScanner(sequencesFile)
-		solutionsFile, _ := os.Open(v.Solutions)
+		sequencesFile, err := os.Open(testSequences)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sequencesFile.Close()
+		sequences, err := seqio.NewPairReader(sequencesFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		solutionsFile, err := os.Open(v.Solutions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer solutionsFile.Close()
 		solutions := bufio.NewScanner(solutionsFile)
 
 		bar := progressbar.Default(305, k)
@@ -158,15 +269,14 @@ func TestWFA(t *testing.T) {
 			expectedScore, _ := strconv.Atoi(strings.Split(solution, "\t")[0])
 			expectedCIGAR := strings.Split(solution, "\t")[1]
 
-			sequences.Scan()
-			s1 := sequences.Text()
-			s1 = s1[1:]
-
-			sequences.Scan()
-			s2 := sequences.Text()
-			s2 = s2[1:]
+			pair, err := sequences.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s1 := pair.S1
+			s2 := pair.S2
 
-			x := wfa.WFAlign(s1, s2, testPenalties, true)
+			x := wfa.WFAlignWithOptions(s1, s2, testPenalties, true, options)
 			gotScore := x.Score
 			gotCIGAR := x.CIGAR
 
@@ -176,15 +286,8 @@ func TestWFA(t *testing.T) {
 			}
 
 			if gotCIGAR != expectedCIGAR {
-				checkScore := GetScoreFromCIGAR(gotCIGAR, testPenalties)
-				CIGARCorrectness := CheckCIGARCorrectness(s1, s2, gotCIGAR)
-				if checkScore != gotScore && checkScore != -1*expectedScore { // nonequivalent alignment
-					t.Errorf(`test: %s#%d, s1: %s, s2: %s, got: [%s], expected: [%s]`, testName, idx, s1, s2, gotCIGAR, expectedCIGAR)
-					t.Errorf(`test: %s#%d, recalculated score: %d`, testName, idx, checkScore)
-					os.Exit(1)
-				}
-				if !CIGARCorrectness {
-					t.Errorf(`test: %s#%d, s1: %s, s2: %s, got: [%s], expected: [%s]`, testName, idx, s1, s2, gotCIGAR, expectedCIGAR)
+				if err := CheckCIGAR(gotCIGAR, testPenalties, options.Distance, gotScore, s1, s2); err != nil { // nonequivalent alignment
+					t.Errorf(`test: %s#%d, s1: %s, s2: %s, got: [%s], expected: [%s]: %v`, testName, idx, s1, s2, gotCIGAR, expectedCIGAR, err)
 					os.Exit(1)
 				}
 			}
@@ -194,3 +297,612 @@ func TestWFA(t *testing.T) {
 		}
 	}
 }
+
+func TestMatchPenalty(t *testing.T) {
+	for i := range 400 {
+		// random penalties where a match is always better than a mismatch or a gap, including match bonuses
+		testPenalties := wfa.Penalty{M: randRange[int](-4, 3)}
+		testPenalties.X = testPenalties.M + randRange[int](1, 6)
+		testPenalties.O = randRange[int](0, 5)
+		testPenalties.E = max(testPenalties.M/2+1, 0) + randRange[int](0, 4)
+
+		s1 := RandomSequence(randRange[int](0, 150))
+		s2 := MutateSequence(s1, 0.2)
+		options := wfa.Options{Memory: []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow}[i%2]}
+		free := wfa.EndsFree{}
+		if i%3 == 0 && testPenalties.M <= 0 { // skipping characters has to cost at least as much as a match
+			s2 = RandomSequence(randRange[int](0, 30)) + s2 + RandomSequence(randRange[int](0, 30))
+			free = wfa.EndsFree{
+				S1Begin: randRange[int](0, len(s1)+1),
+				S1End:   randRange[int](0, len(s1)+1),
+				S2Begin: randRange[int](0, len(s2)+1),
+				S2End:   randRange[int](0, len(s2)+1),
+			}
+			options.Span = wfa.SpanEndsFree
+			options.EndsFree = free
+		}
+		expectedScore := DPAlign(s1, s2, testPenalties, free)
+
+		x := wfa.WFAlignWithOptions(s1, s2, testPenalties, true, options)
+		if x.Score != expectedScore {
+			t.Fatalf(`test: match#%d, penalties: %v, options: %v, s1: %s, s2: %s, got: %d, expected: %d`, i, testPenalties, options, s1, s2, x.Score, expectedScore)
+		}
+		if CheckCIGAR(x.CIGAR, testPenalties, options.Distance, x.Score, s1[x.S1Begin:x.S1End], s2[x.S2Begin:x.S2End]) != nil {
+			t.Fatalf(`test: match#%d, penalties: %v, options: %v, s1: %s, s2: %s, got: [%s] for s1[%d:%d], s2[%d:%d]`, i, testPenalties, options, s1, s2, x.CIGAR, x.S1Begin, x.S1End, x.S2Begin, x.S2End)
+		}
+
+		y := wfa.WFAlignWithOptions(s1, s2, testPenalties, false, options)
+		if y.Score != expectedScore {
+			t.Fatalf(`test: match#%d, penalties: %v, options: %v, s1: %s, s2: %s, got score only: %d, expected: %d`, i, testPenalties, options, s1, s2, y.Score, expectedScore)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	distances := []wfa.Distance{wfa.DistanceGapLinear, wfa.DistanceEdit, wfa.DistanceIndel}
+	for i := range 240 {
+		distance := distances[i%len(distances)]
+		// the equivalent gap-affine penalties for the reference
+		var testPenalties, expectedPenalties wfa.Penalty
+		switch distance {
+		case wfa.DistanceGapLinear:
+			testPenalties = wfa.Penalty{M: randRange[int](-2, 2), O: randRange[int](0, 5)} // O is ignored
+			testPenalties.X = testPenalties.M + randRange[int](1, 6)
+			testPenalties.E = max(testPenalties.M/2+1, 0) + randRange[int](0, 4)
+			expectedPenalties = wfa.Penalty{M: testPenalties.M, X: testPenalties.X, O: 0, E: testPenalties.E}
+		case wfa.DistanceEdit:
+			testPenalties = wfa.Penalty{M: 3, X: 7, O: 5, E: 2} // ignored
+			expectedPenalties = wfa.Penalty{M: 0, X: 1, O: 0, E: 1}
+		case wfa.DistanceIndel:
+			testPenalties = wfa.Penalty{M: 3, X: 7, O: 5, E: 2} // ignored
+			expectedPenalties = wfa.Penalty{M: 0, X: 1 << 20, O: 0, E: 1}
+		}
+
+		// long enough sequences for the bidirectional alignment to split
+		s1 := RandomSequence(randRange[int](0, 1200))
+		s2 := MutateSequence(s1, 0.2)
+		options := wfa.Options{Distance: distance}
+		free := wfa.EndsFree{}
+		if i%4 == 0 && expectedPenalties.M <= 0 {
+			s2 = RandomSequence(randRange[int](0, 30)) + s2 + RandomSequence(randRange[int](0, 30))
+			free = wfa.EndsFree{
+				S1Begin: randRange[int](0, len(s1)+1),
+				S1End:   randRange[int](0, len(s1)+1),
+				S2Begin: randRange[int](0, len(s2)+1),
+				S2End:   randRange[int](0, len(s2)+1),
+			}
+			options.Span = wfa.SpanEndsFree
+			options.EndsFree = free
+		}
+		expectedScore := DPAlign(s1, s2, expectedPenalties, free)
+
+		for _, memory := range []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow} {
+			options.Memory = memory
+			x := wfa.WFAlignWithOptions(s1, s2, testPenalties, true, options)
+			if x.Score != expectedScore {
+				t.Fatalf(`test: distance#%d, penalties: %v, options: %v, s1: %s, s2: %s, got: %d, expected: %d`, i, testPenalties, options, s1, s2, x.Score, expectedScore)
+			}
+			if CheckCIGAR(x.CIGAR, testPenalties, options.Distance, x.Score, s1[x.S1Begin:x.S1End], s2[x.S2Begin:x.S2End]) != nil {
+				t.Fatalf(`test: distance#%d, penalties: %v, options: %v, s1: %s, s2: %s, got: [%s] for s1[%d:%d], s2[%d:%d]`, i, testPenalties, options, s1, s2, x.CIGAR, x.S1Begin, x.S1End, x.S2Begin, x.S2End)
+			}
+
+			y := wfa.WFAlignWithOptions(s1, s2, testPenalties, false, options)
+			if y.Score != expectedScore {
+				t.Fatalf(`test: distance#%d, penalties: %v, options: %v, s1: %s, s2: %s, got score only: %d, expected: %d`, i, testPenalties, options, s1, s2, y.Score, expectedScore)
+			}
+		}
+	}
+}
+
+func TestGapAffine2p(t *testing.T) {
+	for i := range 200 {
+		// a short piece with a low open and a long piece with a low extend, as used for long reads
+		testPenalties := wfa.Penalty{M: randRange[int](-2, 1), O: randRange[int](0, 5), E: randRange[int](2, 5)}
+		testPenalties.X = max(testPenalties.M+1, 0) + randRange[int](1, 6)
+		testPenalties.O2 = testPenalties.O + randRange[int](2, 20)
+		testPenalties.E2 = randRange[int](1, testPenalties.E)
+
+		// long gaps so that the second piece pays off
+		s1 := RandomSequence(randRange[int](0, 1000))
+		s2 := MutateSequence(s1, 0.05)
+		for range randRange[int](0, 4) {
+			at := randRange[int](0, len(s2)+1)
+			s2 = s2[:at] + RandomSequence(randRange[int](0, 60)) + s2[at:]
+		}
+		if i%2 == 1 {
+			s1, s2 = s2, s1
+		}
+		options := wfa.Options{Distance: wfa.DistanceGapAffine2p}
+		free := wfa.EndsFree{}
+		if i%4 == 0 {
+			s2 = RandomSequence(randRange[int](0, 30)) + s2 + RandomSequence(randRange[int](0, 30))
+			free = wfa.EndsFree{
+				S1Begin: randRange[int](0, len(s1)+1),
+				S1End:   randRange[int](0, len(s1)+1),
+				S2Begin: randRange[int](0, len(s2)+1),
+				S2End:   randRange[int](0, len(s2)+1),
+			}
+			options.Span = wfa.SpanEndsFree
+			options.EndsFree = free
+		}
+		expectedScore := DPAlign2p(s1, s2, testPenalties, free)
+
+		for _, memory := range []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow} {
+			options.Memory = memory
+			x := wfa.WFAlignWithOptions(s1, s2, testPenalties, true, options)
+			if x.Score != expectedScore {
+				t.Fatalf(`test: 2p#%d, penalties: %v, options: %v, s1: %s, s2: %s, got: %d, expected: %d`, i, testPenalties, options, s1, s2, x.Score, expectedScore)
+			}
+			if CheckCIGAR(x.CIGAR, testPenalties, wfa.DistanceGapAffine2p, x.Score, s1[x.S1Begin:x.S1End], s2[x.S2Begin:x.S2End]) != nil {
+				t.Fatalf(`test: 2p#%d, penalties: %v, options: %v, s1: %s, s2: %s, got: [%s] for s1[%d:%d], s2[%d:%d]`, i, testPenalties, options, s1, s2, x.CIGAR, x.S1Begin, x.S1End, x.S2Begin, x.S2End)
+			}
+
+			y := wfa.WFAlignWithOptions(s1, s2, testPenalties, false, options)
+			if y.Score != expectedScore {
+				t.Fatalf(`test: 2p#%d, penalties: %v, options: %v, s1: %s, s2: %s, got score only: %d, expected: %d`, i, testPenalties, options, s1, s2, y.Score, expectedScore)
+			}
+		}
+	}
+}
+
+func TestReduction(t *testing.T) {
+	penalties := []wfa.Penalty{{M: 0, X: 4, O: 6, E: 2}, {M: 0, X: 1, O: 0, E: 1}, {M: -1, X: 3, O: 4, E: 2}}
+	for i := range 120 {
+		testPenalties := penalties[i%len(penalties)]
+		s1 := RandomSequence(randRange[int](0, 1500))
+		s2 := MutateSequence(s1, 0.1)
+		expectedScore := DPAlign(s1, s2, testPenalties, wfa.EndsFree{})
+
+		for _, memory := range []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow} {
+			// a reduction which never drops a diagonal of an optimal path keeps the result optimal
+			options := wfa.Options{Memory: memory, Heuristic: wfa.Heuristic{Reduction: &wfa.Reduction{MinWavefrontLength: 10, MaxDistance: 1 << 20, Steps: 1}}}
+			x := wfa.WFAlignWithOptions(s1, s2, testPenalties, true, options)
+			if x.Score != expectedScore || x.Suboptimal {
+				t.Fatalf(`test: reduction#%d, memory: %d, s1: %s, s2: %s, got: %d (suboptimal: %t), expected: %d`, i, memory, s1, s2, x.Score, x.Suboptimal, expectedScore)
+			}
+
+			// a tight reduction may lose the optimum but still has to return a consistent alignment
+			options.Heuristic.Reduction = &wfa.Reduction{MinWavefrontLength: 10, MaxDistance: randRange[int](0, 50), Steps: randRange[int](1, 4)}
+			y := wfa.WFAlignWithOptions(s1, s2, testPenalties, true, options)
+			if y.Score < expectedScore || (y.Score != expectedScore && !y.Suboptimal) {
+				t.Fatalf(`test: reduction#%d, memory: %d, reduction: %v, s1: %s, s2: %s, got: %d (suboptimal: %t), expected at least: %d`, i, memory, *options.Heuristic.Reduction, s1, s2, y.Score, y.Suboptimal, expectedScore)
+			}
+			if CheckCIGAR(y.CIGAR, testPenalties, options.Distance, y.Score, s1, s2) != nil {
+				t.Fatalf(`test: reduction#%d, memory: %d, reduction: %v, s1: %s, s2: %s, got: %d [%s]`, i, memory, *options.Heuristic.Reduction, s1, s2, y.Score, y.CIGAR)
+			}
+		}
+	}
+}
+
+func TestReductionTight(t *testing.T) {
+	// small penalties and distances trim the wavefront down to a few diagonals, which must not lose the end or run past it
+	penalties := []wfa.Penalty{{M: 0, X: 1, O: 4, E: 3}, {M: 0, X: 1, O: 2, E: 2}, {M: -2, X: 1, O: 4, E: 1}}
+	for i := range 60 {
+		testPenalties := penalties[i%len(penalties)]
+		s1 := RandomSequence(randRange[int](1, 700))
+		s2 := MutateSequence(s1, 0.2)
+		free := wfa.EndsFree{}
+		span := wfa.SpanGlobal
+		if i%2 == 1 {
+			free = wfa.EndsFree{S1Begin: randRange[int](0, len(s1)/4+1), S1End: randRange[int](0, len(s1)/4+1), S2Begin: randRange[int](0, len(s2)/4+1), S2End: randRange[int](0, len(s2)/4+1)}
+			span = wfa.SpanEndsFree
+		}
+		expectedScore := DPAlign(s1, s2, testPenalties, free)
+
+		for _, memory := range []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow} {
+			reduction := wfa.Reduction{MinWavefrontLength: randRange[int](1, 12), MaxDistance: randRange[int](0, 14), Steps: 1}
+			options := wfa.Options{Memory: memory, Span: span, EndsFree: free, Heuristic: wfa.Heuristic{Reduction: &reduction}}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			x, err := wfa.WFAlignContext(ctx, s1, s2, testPenalties, true, options)
+			cancel()
+			if err != nil {
+				t.Fatalf(`test: tight reduction#%d, memory: %d, reduction: %v, free: %v, s1: %s, s2: %s, got: %v`, i, memory, reduction, free, s1, s2, err)
+			}
+			if x.S1Begin < 0 || x.S1End > len(s1) || x.S2Begin < 0 || x.S2End > len(s2) || x.S1Begin > free.S1Begin && x.S2Begin > free.S2Begin || len(s1)-x.S1End > free.S1End && len(s2)-x.S2End > free.S2End {
+				t.Fatalf(`test: tight reduction#%d, memory: %d, reduction: %v, free: %v, s1: %s, s2: %s, got: s1[%d:%d], s2[%d:%d]`, i, memory, reduction, free, s1, s2, x.S1Begin, x.S1End, x.S2Begin, x.S2End)
+			}
+			if x.Score < expectedScore || CheckCIGAR(x.CIGAR, testPenalties, options.Distance, x.Score, s1[x.S1Begin:x.S1End], s2[x.S2Begin:x.S2End]) != nil {
+				t.Fatalf(`test: tight reduction#%d, memory: %d, reduction: %v, free: %v, s1: %s, s2: %s, got: %d [%s], expected at least: %d`, i, memory, reduction, free, s1, s2, x.Score, x.CIGAR, expectedScore)
+			}
+		}
+	}
+}
+
+func TestDrop(t *testing.T) {
+	penalties := []wfa.Penalty{{M: -1, X: 4, O: 6, E: 2}, {M: -2, X: 3, O: 2, E: 1}, {M: -1, X: 1, O: 0, E: 1}}
+	for i := range 150 {
+		testPenalties := penalties[i%len(penalties)]
+		// a similar region followed by unrelated tails, where the extension should stop
+		s1 := RandomSequence(randRange[int](0, 800))
+		s2 := MutateSequence(s1, 0.05) + RandomSequence(randRange[int](0, 300))
+		s1 = s1 + RandomSequence(randRange[int](0, 300))
+		if i%2 == 1 {
+			s1, s2 = s2, s1
+		}
+		expectedScore := DPExtend(s1, s2, testPenalties)
+
+		for _, memory := range []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow} {
+			// an X-drop which never drops anything finds the best prefix alignment
+			options := wfa.Options{Memory: memory, Heuristic: wfa.Heuristic{XDrop: 1 << 30}}
+			x := wfa.WFAlignWithOptions(s1, s2, testPenalties, true, options)
+			if x.Score != expectedScore || x.Suboptimal {
+				t.Fatalf(`test: drop#%d, memory: %d, s1: %s, s2: %s, got: %d (suboptimal: %t), expected: %d`, i, memory, s1, s2, x.Score, x.Suboptimal, expectedScore)
+			}
+			if x.S1Begin != 0 || x.S2Begin != 0 || CheckCIGAR(x.CIGAR, testPenalties, options.Distance, x.Score, s1[:x.S1End], s2[:x.S2End]) != nil {
+				t.Fatalf(`test: drop#%d, memory: %d, s1: %s, s2: %s, got: [%s] for s1[%d:%d], s2[%d:%d]`, i, memory, s1, s2, x.CIGAR, x.S1Begin, x.S1End, x.S2Begin, x.S2End)
+			}
+		}
+
+		heuristics := []wfa.Heuristic{{XDrop: randRange[int](5, 40)}, {ZDrop: randRange[int](5, 40)}, {XDrop: randRange[int](5, 40), ZDrop: randRange[int](5, 40)}}
+		for _, heuristic := range heuristics {
+			x := wfa.WFAlignWithOptions(s1, s2, testPenalties, true, wfa.Options{Heuristic: heuristic})
+			if x.Score < expectedScore || CheckCIGAR(x.CIGAR, testPenalties, wfa.DistanceGapAffine, x.Score, s1[:x.S1End], s2[:x.S2End]) != nil {
+				t.Fatalf(`test: drop#%d, heuristic: %v, s1: %s, s2: %s, got: %d [%s] for s1[:%d], s2[:%d], expected at least: %d`, i, heuristic, s1, s2, x.Score, x.CIGAR, x.S1End, x.S2End, expectedScore)
+			}
+
+			// the bidirectional search returns the same extension, with and without the CIGAR
+			y := wfa.WFAlignWithOptions(s1, s2, testPenalties, false, wfa.Options{Memory: wfa.MemoryUltralow, Heuristic: heuristic})
+			z := wfa.WFAlignWithOptions(s1, s2, testPenalties, true, wfa.Options{Memory: wfa.MemoryUltralow, Heuristic: heuristic})
+			if y.Score != x.Score || y.S1End != x.S1End || y.S2End != x.S2End || z != x {
+				t.Fatalf(`test: drop#%d, heuristic: %v, s1: %s, s2: %s, got: %d for s1[:%d], s2[:%d] and %d [%s] for s1[:%d], s2[:%d], expected: %d [%s] for s1[:%d], s2[:%d]`, i, heuristic, s1, s2, y.Score, y.S1End, y.S2End, z.Score, z.CIGAR, z.S1End, z.S2End, x.Score, x.CIGAR, x.S1End, x.S2End)
+			}
+		}
+	}
+}
+
+func TestMaxScore(t *testing.T) {
+	penalties := []wfa.Penalty{{M: 0, X: 4, O: 6, E: 2}, {M: -1, X: 3, O: 4, E: 2}, {M: 1, X: 3, O: 1, E: 1}}
+	for i := range 200 {
+		testPenalties := penalties[i%len(penalties)]
+		s1 := RandomSequence(randRange[int](0, 600))
+		s2 := MutateSequence(s1, 0.1)
+		if i%5 == 0 { // unrelated sequences
+			s2 = RandomSequence(randRange[int](0, 600))
+		}
+		options := wfa.Options{}
+		free := wfa.EndsFree{}
+		if i%4 == 1 && testPenalties.M <= 0 {
+			s2 = RandomSequence(randRange[int](0, 30)) + s2 + RandomSequence(randRange[int](0, 30))
+			free = wfa.EndsFree{
+				S1Begin: randRange[int](0, len(s1)+1),
+				S1End:   randRange[int](0, len(s1)+1),
+				S2Begin: randRange[int](0, len(s2)+1),
+				S2End:   randRange[int](0, len(s2)+1),
+			}
+			options.Span = wfa.SpanEndsFree
+			options.EndsFree = free
+		}
+		expectedScore := DPAlign(s1, s2, testPenalties, free)
+
+		for _, memory := range []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow} {
+			for _, maxScore := range []int{expectedScore - 1 - randRange[int](0, 20), expectedScore, expectedScore + randRange[int](0, 20)} {
+				options.Memory = memory
+				options.Bounded = true
+				options.MaxScore = maxScore
+				for _, doCIGAR := range []bool{true, false} {
+					x := wfa.WFAlignWithOptions(s1, s2, testPenalties, doCIGAR, options)
+					if expectedScore > maxScore && x.Status != wfa.StatusMaxScoreExceeded {
+						t.Fatalf(`test: maxscore#%d, memory: %d, max score: %d, s1: %s, s2: %s, got: %s (%d), expected: %d`, i, memory, maxScore, s1, s2, x.Status, x.Score, expectedScore)
+					}
+					if expectedScore <= maxScore && (x.Status != wfa.StatusOK || x.Score != expectedScore) {
+						t.Fatalf(`test: maxscore#%d, memory: %d, max score: %d, s1: %s, s2: %s, got: %s (%d), expected: %d`, i, memory, maxScore, s1, s2, x.Status, x.Score, expectedScore)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	penalties := []wfa.Penalty{{M: -1, X: 4, O: 6, E: 2}, {M: -2, X: 3, O: 2, E: 1}, {M: -1, X: 1, O: 0, E: 1}, {M: -2, X: 4, O: 4, E: 2, O2: 12, E2: 1}}
+	for i := range 200 {
+		testPenalties := penalties[i%len(penalties)]
+		options := wfa.Options{Span: wfa.SpanLocal}
+		if testPenalties.O2 != 0 {
+			options.Distance = wfa.DistanceGapAffine2p
+		} else if testPenalties.O == 0 && i%2 == 0 {
+			options.Distance = wfa.DistanceGapLinear
+		}
+		// a similar region embedded in unrelated flanks of both sequences
+		region := RandomSequence(randRange[int](0, 500))
+		s1 := RandomSequence(randRange[int](0, 200)) + region + RandomSequence(randRange[int](0, 200))
+		s2 := RandomSequence(randRange[int](0, 200)) + MutateSequence(region, 0.1) + RandomSequence(randRange[int](0, 200))
+		if i%5 == 0 { // unrelated sequences
+			s2 = RandomSequence(randRange[int](0, 300))
+		}
+		expectedScore := DPLocal(s1, s2, testPenalties)
+
+		for _, memory := range []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow} {
+			options.Memory = memory
+			x := wfa.WFAlignWithOptions(s1, s2, testPenalties, true, options)
+			if x.Score != expectedScore {
+				t.Fatalf(`test: local#%d, penalties: %v, options: %v, s1: %s, s2: %s, got: %d, expected: %d`, i, testPenalties, options, s1, s2, x.Score, expectedScore)
+			}
+			if CheckCIGAR(x.CIGAR, testPenalties, options.Distance, x.Score, s1[x.S1Begin:x.S1End], s2[x.S2Begin:x.S2End]) != nil {
+				t.Fatalf(`test: local#%d, penalties: %v, options: %v, s1: %s, s2: %s, got: [%s] for s1[%d:%d], s2[%d:%d]`, i, testPenalties, options, s1, s2, x.CIGAR, x.S1Begin, x.S1End, x.S2Begin, x.S2End)
+			}
+
+			y := wfa.WFAlignWithOptions(s1, s2, testPenalties, false, options)
+			if y.Score != expectedScore || y.S1End != x.S1End || y.S2End != x.S2End {
+				t.Fatalf(`test: local#%d, penalties: %v, options: %v, s1: %s, s2: %s, got score only: %d for s1[:%d], s2[:%d], expected: %d for s1[:%d], s2[:%d]`, i, testPenalties, options, s1, s2, y.Score, y.S1End, y.S2End, expectedScore, x.S1End, x.S2End)
+			}
+		}
+	}
+
+	// without a match bonus nothing aligns for less than the empty alignment
+	x := wfa.WFAlignWithOptions("ACGT", "ACGT", wfa.Penalty{M: 0, X: 4, O: 6, E: 2}, true, wfa.Options{Span: wfa.SpanLocal})
+	if x.Score != 0 || x.CIGAR != "" {
+		t.Fatalf(`test: local, got: %d [%s], expected: 0 []`, x.Score, x.CIGAR)
+	}
+}
+
+func TestAligner(t *testing.T) {
+	penalties := wfa.Penalty{M: -1, X: 4, O: 6, E: 2, O2: 20, E2: 1}
+	options := []wfa.Options{
+		{},
+		{Memory: wfa.MemoryUltralow},
+		{Distance: wfa.DistanceGapAffine2p},
+		{Distance: wfa.DistanceEdit},
+		{Span: wfa.SpanEndsFree, EndsFree: wfa.EndsFree{S1Begin: 20, S1End: 20, S2Begin: 20, S2End: 20}},
+		{Span: wfa.SpanLocal, Memory: wfa.MemoryUltralow},
+		{Heuristic: wfa.Heuristic{XDrop: 30}},
+		{Bounded: true, MaxScore: 40},
+	}
+	// alignments of different lengths in turn so that the pooled wavefronts are reused at other sizes
+	aligners := make([]*wfa.Aligner, len(options))
+	for i := range options {
+		aligners[i] = wfa.NewAligner(penalties, options[i])
+	}
+	for i := range 60 {
+		s1 := RandomSequence(randRange[int](0, 800))
+		s2 := MutateSequence(s1, 0.1)
+		for j, aligner := range aligners {
+			doCIGAR := i%3 != 0
+			expected := wfa.WFAlignWithOptions(s1, s2, penalties, doCIGAR, options[j])
+			x := aligner.Align(s1, s2, doCIGAR)
+			if x != expected {
+				t.Fatalf(`test: aligner#%d, options: %v, s1: %s, s2: %s, got: %v, expected: %v`, i, options[j], s1, s2, x, expected)
+			}
+		}
+		if i%10 == 9 {
+			aligners[i%len(aligners)].Reset()
+		}
+	}
+
+	// aligners shared between goroutines through a sync.Pool
+	pool := sync.Pool{New: func() any { return wfa.NewAligner(penalties, wfa.Options{}) }}
+	var wg sync.WaitGroup
+	errors := make(chan string, 8)
+	for range 8 {
+		wg.Go(func() {
+			for range 20 {
+				s1 := RandomSequence(randRange[int](0, 500))
+				s2 := MutateSequence(s1, 0.1)
+				aligner := pool.Get().(*wfa.Aligner)
+				x := aligner.Align(s1, s2, true)
+				pool.Put(aligner)
+				if expected := wfa.WFAlign(s1, s2, penalties, true); x != expected {
+					errors <- fmt.Sprintf(`s1: %s, s2: %s, got: %v, expected: %v`, s1, s2, x, expected)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+	close(errors)
+	for err := range errors {
+		t.Fatalf(`test: aligner pool, %s`, err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	penalties := wfa.Penalty{M: 0, X: 4, O: 6, E: 2}
+	pairs := make([]wfa.Pair, 300)
+	for i := range pairs {
+		s1 := RandomSequence(randRange[int](0, 500))
+		pairs[i] = wfa.Pair{ID: 1000 + i, S1: s1, S2: MutateSequence(s1, 0.1)}
+	}
+
+	for _, options := range []wfa.Options{{}, {Memory: wfa.MemoryUltralow}, {Bounded: true, MaxScore: 100}} {
+		for _, workers := range []int{0, 1, 7} {
+			// the batch keeps the order of the pairs
+			results := wfa.AlignBatch(pairs, penalties, true, options, workers)
+			if len(results) != len(pairs) {
+				t.Fatalf(`test: batch, options: %v, workers: %d, got %d results, expected: %d`, options, workers, len(results), len(pairs))
+			}
+			for i, x := range results {
+				expected := wfa.WFAlignWithOptions(pairs[i].S1, pairs[i].S2, penalties, true, options)
+				if x.ID != pairs[i].ID || x.Err != nil || x.Result != expected {
+					t.Fatalf(`test: batch#%d, options: %v, workers: %d, got: %d %v (%v), expected: %d %v`, i, options, workers, x.ID, x.Result, x.Err, pairs[i].ID, expected)
+				}
+			}
+
+			// the stream tags the results with the IDs of the pairs
+			in := make(chan wfa.Pair)
+			go func() {
+				for _, pair := range pairs {
+					in <- pair
+				}
+				close(in)
+			}()
+			seen := map[int]bool{}
+			for x := range wfa.AlignStream(in, penalties, false, options, workers) {
+				i := x.ID - 1000
+				if i < 0 || i >= len(pairs) || seen[x.ID] {
+					t.Fatalf(`test: stream, options: %v, workers: %d, got unexpected ID %d`, options, workers, x.ID)
+				}
+				seen[x.ID] = true
+				expected := wfa.WFAlignWithOptions(pairs[i].S1, pairs[i].S2, penalties, false, options)
+				if x.Err != nil || x.Result != expected {
+					t.Fatalf(`test: stream#%d, options: %v, workers: %d, got: %v (%v), expected: %v`, i, options, workers, x.Result, x.Err, expected)
+				}
+			}
+			if len(seen) != len(pairs) {
+				t.Fatalf(`test: stream, options: %v, workers: %d, got %d results, expected: %d`, options, workers, len(seen), len(pairs))
+			}
+		}
+	}
+
+	if results := wfa.AlignBatch(nil, penalties, true, wfa.Options{}, 4); len(results) != 0 {
+		t.Fatalf(`test: batch, got %d results for no pairs`, len(results))
+	}
+}
+
+func TestContext(t *testing.T) {
+	penalties := wfa.Penalty{M: 0, X: 4, O: 6, E: 2}
+	aligner := wfa.NewAligner(penalties, wfa.Options{})
+	for i := range 20 {
+		s1 := RandomSequence(randRange[int](0, 1000))
+		s2 := MutateSequence(s1, 0.1)
+		for _, memory := range []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow} {
+			options := wfa.Options{Memory: memory}
+
+			// a context which is never done gives the same alignment
+			expected := wfa.WFAlignWithOptions(s1, s2, penalties, true, options)
+			x, err := wfa.WFAlignContext(context.Background(), s1, s2, penalties, true, options)
+			if err != nil || x != expected {
+				t.Fatalf(`test: context#%d, memory: %d, s1: %s, s2: %s, got: %v (%v), expected: %v`, i, memory, s1, s2, x, err, expected)
+			}
+
+			// a canceled context stops before aligning
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err = wfa.WFAlignContext(ctx, s1, s2, penalties, true, options)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf(`test: context#%d, memory: %d, got: %v, expected: %v`, i, memory, err, context.Canceled)
+			}
+
+			// an aligner keeps working after an alignment was canceled
+			aligner.Options = options
+			_, err = aligner.AlignContext(ctx, s1, s2, true)
+			y := aligner.Align(s1, s2, true)
+			if !errors.Is(err, context.Canceled) || y != expected {
+				t.Fatalf(`test: context#%d, memory: %d, got: %v (%v), expected: %v`, i, memory, y, err, expected)
+			}
+		}
+	}
+
+	// unrelated sequences take far longer than the deadline, which stops them within a few wavefronts
+	s1 := RandomSequence(200_000)
+	s2 := RandomSequence(200_000)
+	for _, options := range []wfa.Options{{}, {Memory: wfa.MemoryUltralow}, {Span: wfa.SpanLocal}} {
+		for _, doCIGAR := range []bool{true, false} {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			start := time.Now()
+			_, err := wfa.WFAlignContext(ctx, s1, s2, wfa.Penalty{M: -1, X: 4, O: 6, E: 2}, doCIGAR, options)
+			elapsed := time.Since(start)
+			cancel()
+			var canceled *wfa.CanceledError
+			if !errors.Is(err, context.DeadlineExceeded) || !errors.As(err, &canceled) || canceled.Score <= 0 || canceled.Width <= 0 {
+				t.Fatalf(`test: context, options: %v, doCIGAR: %t, got: %v, expected: %v with progress`, options, doCIGAR, err, context.DeadlineExceeded)
+			}
+			if elapsed > time.Second {
+				t.Fatalf(`test: context, options: %v, doCIGAR: %t, canceled after %v`, options, doCIGAR, elapsed)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := []struct {
+		penalties wfa.Penalty
+		options   wfa.Options
+	}{
+		{wfa.Penalty{M: 0, X: 4, O: 6, E: 2}, wfa.Options{}},
+		{wfa.Penalty{M: -3, X: -2, O: 0, E: -1}, wfa.Options{}},
+		{wfa.Penalty{M: 1, X: 2, O: 0, E: 1}, wfa.Options{}},
+		{wfa.Penalty{M: 0, X: 0, O: 0, E: 0}, wfa.Options{Distance: wfa.DistanceEdit}},
+		{wfa.Penalty{M: 0, X: 1, O: -5, E: 1}, wfa.Options{Distance: wfa.DistanceGapLinear}},
+		{wfa.Penalty{M: 0, X: 4, O: 6, E: 2, O2: 24, E2: 1}, wfa.Options{Distance: wfa.DistanceGapAffine2p}},
+		{wfa.Penalty{M: 1, X: 4, O: 6, E: 2}, wfa.Options{Span: wfa.SpanEndsFree, Heuristic: wfa.Heuristic{XDrop: 10}}},
+	}
+	for _, c := range valid {
+		if err := wfa.Validate(10, 10, c.penalties, c.options); err != nil {
+			t.Fatalf(`test: validate, penalties: %v, options: %v, got: %v, expected no error`, c.penalties, c.options, err)
+		}
+	}
+
+	invalid := []struct {
+		n         int
+		penalties wfa.Penalty
+		options   wfa.Options
+		err       error
+	}{
+		{10, wfa.Penalty{M: 0, X: 0, O: 6, E: 2}, wfa.Options{}, wfa.ErrInvalidPenalty},
+		{10, wfa.Penalty{M: 0, X: 4, O: 0, E: 0}, wfa.Options{}, wfa.ErrInvalidPenalty},
+		{10, wfa.Penalty{M: 0, X: 4, O: -1, E: 2}, wfa.Options{}, wfa.ErrInvalidPenalty},
+		{10, wfa.Penalty{M: 2, X: 4, O: 6, E: 1}, wfa.Options{}, wfa.ErrInvalidPenalty},
+		{10, wfa.Penalty{M: 0, X: 4, O: 6, E: 2, O2: 24, E2: 0}, wfa.Options{Distance: wfa.DistanceGapAffine2p}, wfa.ErrInvalidPenalty},
+		{10, wfa.Penalty{M: 0, X: 4, O: 6, E: 2, O2: -1, E2: 1}, wfa.Options{Distance: wfa.DistanceGapAffine2p}, wfa.ErrInvalidPenalty},
+		{10, wfa.Penalty{M: 1, X: 4, O: 6, E: 2}, wfa.Options{Span: wfa.SpanEndsFree}, wfa.ErrInvalidPenalty},
+		{10, wfa.Penalty{M: 0, X: 4, O: 6, E: 2}, wfa.Options{Distance: wfa.DistanceIndel + 1}, wfa.ErrInvalidOptions},
+		{10, wfa.Penalty{M: 0, X: 4, O: 6, E: 2}, wfa.Options{Heuristic: wfa.Heuristic{Reduction: &wfa.Reduction{Steps: 0}}}, wfa.ErrInvalidOptions},
+		{10, wfa.Penalty{M: 0, X: 4, O: 6, E: 2}, wfa.Options{Heuristic: wfa.Heuristic{XDrop: -1}}, wfa.ErrInvalidOptions},
+		{wfa.MaxSequenceLength + 1, wfa.Penalty{M: 0, X: 4, O: 6, E: 2}, wfa.Options{}, wfa.ErrSequenceTooLong},
+	}
+	for _, c := range invalid {
+		if err := wfa.Validate(c.n, 10, c.penalties, c.options); !errors.Is(err, c.err) {
+			t.Fatalf(`test: validate, n: %d, penalties: %v, options: %v, got: %v, expected: %v`, c.n, c.penalties, c.options, err, c.err)
+		}
+	}
+
+	// the error-returning entry points check before aligning
+	if _, err := wfa.WFAlignChecked("ACGT", "ACT", wfa.Penalty{M: 0, X: 0, O: 0, E: 0}, true, wfa.Options{}); !errors.Is(err, wfa.ErrInvalidPenalty) {
+		t.Fatalf(`test: validate, got: %v, expected: %v`, err, wfa.ErrInvalidPenalty)
+	}
+	if x, err := wfa.WFAlignChecked("ACGT", "ACT", wfa.Penalty{M: 0, X: 4, O: 6, E: 2}, true, wfa.Options{}); err != nil || x.Score != 8 {
+		t.Fatalf(`test: validate, got: %v (%v), expected: 8`, x, err)
+	}
+	results := wfa.AlignBatch([]wfa.Pair{{ID: 1, S1: "ACGT", S2: "ACT"}}, wfa.Penalty{M: 0, X: 4, O: -6, E: 2}, true, wfa.Options{}, 1)
+	if !errors.Is(results[0].Err, wfa.ErrInvalidPenalty) {
+		t.Fatalf(`test: validate, got: %v, expected: %v`, results[0].Err, wfa.ErrInvalidPenalty)
+	}
+}
+
+func TestLongSequences(t *testing.T) {
+	// megabase sequences in the bidirectional mode, which keeps O(s) memory for whole chromosomes
+	penalties := wfa.Penalty{M: 0, X: 4, O: 6, E: 2}
+	s1 := RandomSequence(1_000_000)
+	s2 := MutateSequence(s1, 0.001)
+	expected := wfa.WFAlign(s1, s2, penalties, false)
+	x := wfa.WFAlignWithOptions(s1, s2, penalties, true, wfa.Options{Memory: wfa.MemoryUltralow})
+	if err := CheckCIGAR(x.CIGAR, penalties, wfa.DistanceGapAffine, x.Score, s1, s2); x.Score != expected.Score || err != nil {
+		t.Fatalf(`test: long, got: %d (%v), expected: %d`, x.Score, err, expected.Score)
+	}
+}
+
+func TestAlignment(t *testing.T) {
+	penalties := wfa.Penalty{M: 0, X: 4, O: 6, E: 2}
+	result := wfa.WFAlign("GATTACAGATTACAGATTACA", "GATTACAGTTACAGATTTTACA", penalties, true)
+	alignment := result.Alignment()
+	expected := `{"status":"ok","score":18,"CIGAR":"8M1D9M2I3M","ops":[{"op":"M","length":8},{"op":"D","length":1},{"op":"M","length":9},{"op":"I","length":2},{"op":"M","length":3}],` +
+		`"s1Begin":0,"s1End":21,"s2Begin":0,"s2End":22,"matches":20,"mismatches":0,"insertions":2,"deletions":1,"gapOpens":2,"identity":0.8695652173913043,"gapCompressedIdentity":0.9090909090909091,"suboptimal":false}`
+	if got, err := json.Marshal(alignment); err != nil || string(got) != expected {
+		t.Fatalf("test: alignment JSON, got: %s (%v), expected: %s", got, err, expected)
+	}
+
+	for i := range 200 {
+		s1 := RandomSequence(randRange[int](0, 300))
+		s2 := MutateSequence(s1, 0.1)
+		options := wfa.Options{Memory: []wfa.MemoryMode{wfa.MemoryHigh, wfa.MemoryUltralow}[i%2]}
+		alignment := wfa.WFAlignWithOptions(s1, s2, penalties, true, options).Alignment()
+
+		decoded := wfa.RunLengthDecode(alignment.CIGAR)
+		var runs strings.Builder
+		for _, run := range alignment.Ops {
+			runs.WriteString(strings.Repeat(run.Op.String(), run.Length))
+		}
+		gaps := len(strings.FieldsFunc(decoded, func(r rune) bool { return r != 'I' })) + len(strings.FieldsFunc(decoded, func(r rune) bool { return r != 'D' }))
+		if runs.String() != decoded || alignment.Matches != strings.Count(decoded, "M") || alignment.Mismatches != strings.Count(decoded, "X") ||
+			alignment.Insertions != strings.Count(decoded, "I") || alignment.Deletions != strings.Count(decoded, "D") || alignment.GapOpens != gaps {
+			t.Fatalf("test: alignment#%d, CIGAR: %s, got: %+v", i, alignment.CIGAR, alignment)
+		}
+		if alignment.Matches+alignment.Mismatches+alignment.Deletions != alignment.S1End-alignment.S1Begin ||
+			alignment.Matches+alignment.Mismatches+alignment.Insertions != alignment.S2End-alignment.S2Begin {
+			t.Fatalf("test: alignment#%d, counts do not cover s1[%d:%d], s2[%d:%d], got: %+v", i, alignment.S1Begin, alignment.S1End, alignment.S2Begin, alignment.S2End, alignment)
+		}
+		if len(decoded) > 0 && (alignment.Identity <= 0 || alignment.Identity > alignment.GapCompressedIdentity || alignment.GapCompressedIdentity > 1) {
+			t.Fatalf("test: alignment#%d, identities out of order, got: %+v", i, alignment)
+		}
+	}
+}